@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ANSI 颜色
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiDim    = "\x1b[2m"
+	ansiGreen  = "\x1b[32m"
+	ansiCyan   = "\x1b[36m"
+	ansiWhite  = "\x1b[97m"
+	ansiGray   = "\x1b[90m"
+	ansiBorder = "\x1b[38;5;67m"
+)
+
+const ansiMaxValueWidth = 60
+
+type ansiLine struct {
+	label string
+	value string
+	color string
+}
+
+// renderANSI 生成终端使用的彩色文本卡片，内容与图片卡片一致
+func renderANSI(d cardData) string {
+	fields := d.Fields
+	if len(fields) == 0 {
+		fields = cardPresets["default"].Fields
+	}
+
+	var lines []ansiLine
+	for _, name := range fields {
+		f := cardFields[name]
+		value := truncateWidth(stripControl(f.value(d)), ansiMaxValueWidth)
+		if value == "" {
+			continue
+		}
+		color := ansiWhite
+		switch {
+		case len(lines) == 0:
+			color = ansiBold + ansiWhite
+		case f.wide:
+			color = ansiGray
+		}
+		lines = append(lines, ansiLine{f.label(d.Msg), value, color})
+	}
+
+	labelWidth := 0
+	for _, l := range lines {
+		labelWidth = max(labelWidth, displayWidth(l.label))
+	}
+
+	status := "● " + d.Msg.Online
+	inner := displayWidth(status)
+	for _, l := range lines {
+		inner = max(inner, labelWidth+2+displayWidth(l.value))
+	}
+
+	var b strings.Builder
+	border := func(left, right string) {
+		b.WriteString(ansiBorder + left + strings.Repeat("─", inner+2) + right + ansiReset + "\n")
+	}
+	row := func(content string, width int) {
+		b.WriteString(ansiBorder + "│ " + ansiReset)
+		b.WriteString(content)
+		b.WriteString(strings.Repeat(" ", inner-width))
+		b.WriteString(ansiBorder + " │" + ansiReset + "\n")
+	}
+
+	border("╭", "╮")
+	row(ansiGreen+status+ansiReset, displayWidth(status))
+	for _, l := range lines {
+		pad := strings.Repeat(" ", labelWidth-displayWidth(l.label)+2)
+		row(ansiCyan+l.label+ansiReset+pad+l.color+l.value+ansiReset, labelWidth+2+displayWidth(l.value))
+	}
+	border("╰", "╯")
+	return b.String()
+}
+
+// stripControl 去掉控制字符，防止上游数据中的转义序列影响终端
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// displayWidth 计算字符串在终端中的显示宽度，中日韩等宽字符占两列
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+func runeWidth(r rune) int {
+	switch {
+	case r == 0 || unicode.Is(unicode.Mn, r) || unicode.IsControl(r):
+		return 0
+	case isWideRune(r):
+		return 2
+	default:
+		return 1
+	}
+}
+
+func isWideRune(r rune) bool {
+	return (r >= 0x1100 && r <= 0x115F) ||
+		(r >= 0x2E80 && r <= 0x303E) ||
+		(r >= 0x3041 && r <= 0x33FF) ||
+		(r >= 0x3400 && r <= 0x4DBF) ||
+		(r >= 0x4E00 && r <= 0x9FFF) ||
+		(r >= 0xA000 && r <= 0xA4CF) ||
+		(r >= 0xAC00 && r <= 0xD7A3) ||
+		(r >= 0xF900 && r <= 0xFAFF) ||
+		(r >= 0xFE30 && r <= 0xFE4F) ||
+		(r >= 0xFF00 && r <= 0xFF60) ||
+		(r >= 0xFFE0 && r <= 0xFFE6) ||
+		(r >= 0x1F300 && r <= 0x1F64F) ||
+		(r >= 0x1F900 && r <= 0x1F9FF) ||
+		(r >= 0x20000 && r <= 0x3FFFD)
+}
+
+// truncateWidth 按显示宽度截断字符串，超出时以 "..." 结尾，不会截断多字节字符
+func truncateWidth(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+
+	var b strings.Builder
+	w := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		rw := runeWidth(r)
+		if w+rw > width-3 {
+			break
+		}
+		b.WriteRune(r)
+		w += rw
+		s = s[size:]
+	}
+	return b.String() + "..."
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheOptions 地理位置缓存配置
+type CacheOptions struct {
+	Size        int           // 最多缓存的 IP 数量
+	TTL         time.Duration // 查询成功的缓存时间
+	NegativeTTL time.Duration // 查询失败或无结果的缓存时间
+	File        string        // 快照文件，关闭时写入、启动时读取，留空不持久化
+}
+
+// geoCache 带过期时间的 LRU 缓存，Info 为 nil 的条目表示查询失败（负缓存）
+type geoCache struct {
+	mu          sync.Mutex
+	capacity    int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	ll          *list.List
+	items       map[string]*list.Element
+	now         func() time.Time // 测试时替换
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheEntry struct {
+	IP      string    `json:"ip"`
+	Info    *GeoInfo  `json:"info,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+type cacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+func newGeoCache(capacity int, ttl, negativeTTL time.Duration) *geoCache {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &geoCache{
+		capacity:    capacity,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		ll:          list.New(),
+		items:       make(map[string]*list.Element),
+		now:         time.Now,
+	}
+}
+
+// Get 返回缓存的查询结果，ok 为 false 表示未命中或已过期
+func (c *geoCache) Get(ip string) (info *GeoInfo, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, found := c.items[ip]
+	if !found {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if c.now().After(entry.Expires) {
+		c.removeElement(el)
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.hits.Add(1)
+	return entry.Info, true
+}
+
+// Set 写入查询结果，info 为 nil 时按负缓存时间保存
+func (c *geoCache) Set(ip string, info *GeoInfo) {
+	ttl := c.ttl
+	if info == nil {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(&cacheEntry{IP: ip, Info: info, Expires: c.now().Add(ttl)})
+}
+
+func (c *geoCache) add(entry *cacheEntry) {
+	if el, found := c.items[entry.IP]; found {
+		el.Value = entry
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[entry.IP] = c.ll.PushFront(entry)
+	for c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *geoCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry).IP)
+}
+
+func (c *geoCache) Stats() cacheStats {
+	c.mu.Lock()
+	size := c.ll.Len()
+	c.mu.Unlock()
+
+	return cacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   size,
+	}
+}
+
+// Save 将未过期的条目按最近使用顺序写入快照文件
+func (c *geoCache) Save(path string) error {
+	now := c.now()
+
+	c.mu.Lock()
+	entries := make([]*cacheEntry, 0, c.ll.Len())
+	for el := c.ll.Front(); el != nil; el = el.Next() {
+		entry := el.Value.(*cacheEntry)
+		if entry.Expires.After(now) {
+			entries = append(entries, entry)
+		}
+	}
+	c.mu.Unlock()
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load 读取快照文件，跳过已过期的条目，返回载入的条目数
+func (c *geoCache) Load(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []*cacheEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, err
+	}
+
+	now := c.now()
+	loaded := 0
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 快照按最近使用顺序保存，倒序插入以保持 LRU 顺序
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry == nil || entry.IP == "" || !entry.Expires.After(now) {
+			continue
+		}
+		c.add(entry)
+		loaded++
+	}
+	return loaded, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeClock 测试用的时钟，只在调用 advance 时前进
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestCache(capacity int, ttl, negativeTTL time.Duration, clock *fakeClock) *geoCache {
+	c := newGeoCache(capacity, ttl, negativeTTL)
+	c.now = clock.now
+	return c
+}
+
+func TestGeoCacheLRU(t *testing.T) {
+	c := newTestCache(2, time.Hour, time.Minute, newFakeClock())
+	c.Set("a", &GeoInfo{Country: "A"})
+	c.Set("b", &GeoInfo{Country: "B"})
+	c.Get("a") // a 变为最近使用
+	c.Set("c", &GeoInfo{Country: "C"})
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("最久未使用的 b 应被淘汰")
+	}
+	for _, ip := range []string{"a", "c"} {
+		if _, ok := c.Get(ip); !ok {
+			t.Errorf("%s 不应被淘汰", ip)
+		}
+	}
+
+	// 更新已有条目同样算作使用
+	c.Set("a", &GeoInfo{Country: "A2"})
+	c.Set("d", &GeoInfo{Country: "D"})
+	if _, ok := c.Get("c"); ok {
+		t.Error("c 应被淘汰")
+	}
+	if info, ok := c.Get("a"); !ok || info.Country != "A2" {
+		t.Errorf("a 应为更新后的值: %+v, %v", info, ok)
+	}
+	if size := c.Stats().Size; size != 2 {
+		t.Errorf("条目数 %d，期望 2", size)
+	}
+}
+
+func TestGeoCacheTTL(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(10, time.Hour, time.Minute, clock)
+	c.Set("ok", &GeoInfo{Country: "AU"})
+	c.Set("failed", nil)
+
+	if info, ok := c.Get("failed"); !ok || info != nil {
+		t.Errorf("负缓存应命中并返回 nil: %+v, %v", info, ok)
+	}
+
+	clock.advance(time.Minute + time.Second)
+	if _, ok := c.Get("failed"); ok {
+		t.Error("负缓存超过 negativeTTL 后应过期")
+	}
+	if _, ok := c.Get("ok"); !ok {
+		t.Error("成功结果在 ttl 内不应过期")
+	}
+
+	clock.advance(time.Hour)
+	if _, ok := c.Get("ok"); ok {
+		t.Error("成功结果超过 ttl 后应过期")
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Errorf("过期条目应在读取时删除，剩余 %d", size)
+	}
+
+	// negativeTTL 为 0 时不缓存失败结果
+	c = newTestCache(10, time.Hour, 0, clock)
+	c.Set("failed", nil)
+	if _, ok := c.Get("failed"); ok {
+		t.Error("negativeTTL 为 0 时不应缓存失败结果")
+	}
+}
+
+func TestGeoCacheStats(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(10, time.Hour, time.Minute, clock)
+	c.Get("a") // 未命中
+	c.Set("a", &GeoInfo{Country: "AU"})
+	c.Get("a") // 命中
+	c.Set("b", nil)
+	c.Get("b") // 负缓存也算命中
+	clock.advance(2 * time.Minute)
+	c.Get("b") // 过期算未命中
+
+	want := cacheStats{Hits: 2, Misses: 2, Size: 1}
+	if got := c.Stats(); got != want {
+		t.Errorf("Stats = %+v，期望 %+v", got, want)
+	}
+}
+
+func TestGeoCacheSaveLoad(t *testing.T) {
+	clock := newFakeClock()
+	c := newTestCache(10, time.Hour, time.Minute, clock)
+	full := &GeoInfo{
+		Country: "JP", Region: "Tokyo", City: "Shinjuku", ISP: "KDDI", Org: "KDDI", ASN: 2516, ASName: "KDDI",
+		Latitude: 35.6895, Longitude: 139.6917, Loc: "35.6895,139.6917", TimeZone: "Asia/Tokyo", Source: "mmdb",
+		Names: map[string]GeoNames{"zh": {Country: "日本", Region: "东京都"}},
+	}
+	c.Set("expired", nil)
+	clock.advance(30 * time.Second)
+	c.Set("a", &GeoInfo{Country: "A"})
+	c.Set("b", full)
+	c.Set("failed", nil)
+	c.Set("c", &GeoInfo{Country: "C"})
+	clock.advance(45 * time.Second) // expired 已过期，failed 仍有效
+
+	path := filepath.Join(t.TempDir(), "cache.json")
+	if err := c.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newTestCache(10, time.Hour, time.Minute, clock)
+	n, err := restored.Load(path)
+	if err != nil || n != 4 {
+		t.Fatalf("Load = %d, %v，期望 4 条", n, err)
+	}
+	if _, ok := restored.Get("expired"); ok {
+		t.Error("保存时已过期的条目不应恢复")
+	}
+	if info, ok := restored.Get("b"); !ok || !reflect.DeepEqual(info, full) {
+		t.Errorf("恢复的结果不一致: %+v", info)
+	}
+	if info, ok := restored.Get("failed"); !ok || info != nil {
+		t.Errorf("负缓存应恢复为 nil: %+v, %v", info, ok)
+	}
+
+	// 过期时间随快照保存，恢复后不会重新计时
+	clock.advance(time.Minute)
+	if _, ok := restored.Get("failed"); ok {
+		t.Error("负缓存应按原过期时间失效")
+	}
+
+	// 恢复后保持 LRU 顺序，容量不足时保留最近使用的条目
+	small := newTestCache(2, time.Hour, time.Minute, newFakeClock())
+	if _, err := small.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{"a": false, "b": false, "failed": true, "c": true} {
+		if _, ok := small.Get(ip); ok != want {
+			t.Errorf("容量为 2 时 %s 命中 %v，期望 %v", ip, ok, want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptClientHints 请求浏览器发送的 User-Agent Client Hints
+var acceptClientHints = []string{
+	"Sec-CH-UA",
+	"Sec-CH-UA-Mobile",
+	"Sec-CH-UA-Platform",
+	"Sec-CH-UA-Platform-Version",
+	"Sec-CH-UA-Full-Version-List",
+	"Sec-CH-UA-Model",
+}
+
+// criticalClientHints 首次请求缺少这些提示时浏览器会带上后重试，
+// 否则第一次访问只能按冻结后的 UA 显示
+var criticalClientHints = []string{
+	"Sec-CH-UA-Platform-Version",
+	"Sec-CH-UA-Full-Version-List",
+}
+
+// chBrands Sec-CH-UA 中的品牌名称与 UA 解析结果的对应关系
+var chBrands = map[string]string{
+	"Google Chrome":    "Chrome",
+	"Microsoft Edge":   "Edge",
+	"Opera":            "Opera",
+	"Opera GX":         "Opera",
+	"Brave":            "Brave",
+	"Vivaldi":          "Vivaldi",
+	"YaBrowser":        "Yandex Browser",
+	"Yandex":           "Yandex Browser",
+	"Samsung Internet": "Samsung Internet",
+	"HeadlessChrome":   "Headless Chrome",
+}
+
+// chPlatforms Sec-CH-UA-Platform 与 UA 解析结果的对应关系
+var chPlatforms = map[string]string{
+	"Windows":     "Windows",
+	"macOS":       "macOS",
+	"Linux":       "Linux",
+	"Android":     "Android",
+	"Chrome OS":   "ChromeOS",
+	"Chromium OS": "ChromeOS",
+	"iOS":         "iOS",
+}
+
+// setClientHintHeaders 声明需要的 Client Hints
+func setClientHintHeaders(h http.Header) {
+	h.Set("Accept-CH", strings.Join(acceptClientHints, ", "))
+	h.Set("Critical-CH", strings.Join(criticalClientHints, ", "))
+}
+
+// parseClientInfo 解析 User-Agent，再用 Client Hints 补充和修正；
+// 没有 Client Hints（非 Chromium 浏览器、首次请求）时只使用 UA
+func parseClientInfo(r *http.Request) ClientInfo {
+	info := parseUserAgent(r.UserAgent())
+	if info.Device != deviceBot {
+		mergeClientHints(&info, r.Header)
+	}
+	return info
+}
+
+// mergeClientHints 将 Client Hints 合并到 UA 解析结果中
+func mergeClientHints(info *ClientInfo, h http.Header) {
+	brands := h.Get("Sec-CH-UA-Full-Version-List")
+	if brands == "" {
+		brands = h.Get("Sec-CH-UA")
+	}
+	if name, version := chBrand(brands); name != "" {
+		// 只有 Chromium 品牌时可能是 Vivaldi 等不单独声明品牌的浏览器，以 UA 为准
+		if name != "Chromium" || info.Browser == "" {
+			info.Browser = name
+		}
+		// Sec-CH-UA 只有主版本号，不覆盖 UA 中更详细的版本
+		if info.Browser == name && version != "" && info.BrowserVersion != version &&
+			!strings.HasPrefix(info.BrowserVersion, version+".") {
+			info.BrowserVersion = version
+		}
+	}
+
+	if platform, ok := chPlatforms[unquoteSF(h.Get("Sec-CH-UA-Platform"))]; ok {
+		if platform != info.OS {
+			info.OS, info.OSVersion = platform, ""
+		}
+		if version := chPlatformVersion(platform, unquoteSF(h.Get("Sec-CH-UA-Platform-Version"))); version != "" {
+			info.OSVersion = version
+		}
+		if info.Device == "" {
+			info.Device = deviceDesktop
+		}
+	}
+
+	if model := unquoteSF(h.Get("Sec-CH-UA-Model")); model != "" {
+		info.Model = model
+	}
+
+	// Android 平板的 Sec-CH-UA-Mobile 为 ?0
+	switch mobile := h.Get("Sec-CH-UA-Mobile"); {
+	case mobile == "?1" && info.Device != deviceTablet:
+		info.Device = deviceMobile
+	case mobile == "?0" && info.Device == deviceMobile && info.OS == "Android":
+		info.Device = deviceTablet
+	}
+}
+
+// chBrand 从 `"Chromium";v="129", "Google Chrome";v="129", "Not=A?Brand";v="8"`
+// 中选出浏览器品牌，跳过用于防止嗅探的 GREASE 品牌，Chromium 优先级最低
+func chBrand(list string) (string, string) {
+	var name, version string
+	for _, item := range splitQuoted(list, ',') {
+		params := splitQuoted(item, ';')
+		brand := unquoteSF(params[0])
+		if brand == "" || strings.Contains(brand, "Brand") {
+			continue
+		}
+		var v string
+		for _, p := range params[1:] {
+			if key, value, ok := strings.Cut(strings.TrimSpace(p), "="); ok && key == "v" {
+				v = unquoteSF(value)
+			}
+		}
+
+		if mapped, ok := chBrands[brand]; ok {
+			return mapped, v
+		}
+		if brand == "Chromium" && name == "" {
+			name, version = "Chromium", v
+		}
+	}
+	return name, version
+}
+
+// chPlatformVersion 转换 Sec-CH-UA-Platform-Version，无法转换时返回空字符串。
+// Windows 返回的是 UniversalApiContract 版本，13 及以上为 Windows 11，0 为 Windows 7/8/8.1
+func chPlatformVersion(platform, version string) string {
+	major, _, _ := strings.Cut(version, ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return ""
+	}
+	if platform == "Windows" {
+		switch {
+		case n >= 13:
+			return "11"
+		case n > 0:
+			return "10"
+		default:
+			return ""
+		}
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(version, ".0"), ".0")
+}
+
+// unquoteSF 去掉结构化字段中字符串两侧的引号
+func unquoteSF(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	return strings.ReplaceAll(s, `\"`, `"`)
+}
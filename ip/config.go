@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// 配置按 配置文件 < 环境变量 < 命令行参数 的顺序覆盖，三者使用相同的配置项：
+// 配置文件中的键与参数名相同，嵌套的键用 - 连接，如 geo: {timeout: 3s} 即 -geo-timeout；
+// 环境变量为 IP_ 加大写的参数名，- 换成 _，如 IP_GEO_TIMEOUT。值为空的环境变量视为未设置，
+// 避免 docker compose 中 IP_X=${X} 在 X 未定义时清空配置文件中的值，需要清空时使用命令行参数
+const envPrefix = "IP_"
+
+// 配置项的来源
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// 只在命令行使用的参数，不从配置文件和环境变量读取
+var commandOnlyFlags = map[string]bool{"config": true, "print-config": true}
+
+// 输出配置时隐藏的参数
+var secretFlags = map[string]bool{"ipinfo-token": true}
+
+// envName 返回参数对应的环境变量名
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyConfig 将配置文件和环境变量中的值设置到命令行没有指定的参数上，返回每个参数的来源
+func applyConfig(fs *flag.FlagSet, path string) (map[string]string, error) {
+	sources := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		sources[f.Name] = sourceFlag
+	})
+
+	var file map[string]string
+	if path != "" {
+		var err error
+		if file, err = readConfigFile(path); err != nil {
+			return nil, err
+		}
+		for key := range file {
+			if fs.Lookup(key) == nil || commandOnlyFlags[key] {
+				return nil, fmt.Errorf("%s: 未知的配置项 %s", path, key)
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || sources[f.Name] != "" {
+			return
+		}
+		sources[f.Name] = sourceDefault
+		if commandOnlyFlags[f.Name] {
+			return
+		}
+
+		source := sourceEnv
+		value := os.Getenv(envName(f.Name))
+		ok := value != ""
+		if !ok {
+			source = sourceFile
+			value, ok = file[f.Name]
+		}
+		if !ok {
+			return
+		}
+		if e := f.Value.Set(value); e != nil {
+			if source == sourceEnv {
+				err = fmt.Errorf("环境变量 %s=%q 无效: %w", envName(f.Name), value, e)
+			} else {
+				err = fmt.Errorf("%s: 配置项 %s=%q 无效: %w", path, f.Name, value, e)
+			}
+			return
+		}
+		sources[f.Name] = source
+	})
+	return sources, err
+}
+
+// readConfigFile 按扩展名读取 YAML、JSON 或 TOML 配置文件，展开为参数名到值的映射
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("不支持的配置文件格式: %s，可选 .yaml、.yml、.json、.toml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	if err := flattenConfig(values, "", raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flattenConfig 将嵌套的键用 - 连接，列表用逗号连接，与命令行参数的写法一致
+func flattenConfig(values map[string]string, prefix string, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, child := range v {
+			key = strings.ReplaceAll(strings.ToLower(key), "_", "-")
+			if prefix != "" {
+				key = prefix + "-" + key
+			}
+			if err := flattenConfig(values, key, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := configScalar(prefix, item)
+			if err != nil {
+				return err
+			}
+			items[i] = s
+		}
+		values[prefix] = strings.Join(items, ",")
+		return nil
+	default:
+		s, err := configScalar(prefix, v)
+		if err != nil {
+			return err
+		}
+		values[prefix] = s
+		return nil
+	}
+}
+
+// configScalar 将配置文件中的单个值转换为参数的字符串形式
+func configScalar(key string, v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("配置项 %s 的值类型不支持: %T", key, v)
+	}
+}
+
+// printConfig 以 YAML 输出合并后的全部配置，注释标明每项的来源。
+// 输出可以直接作为配置文件使用，但 token 等密钥只显示是否已设置
+func printConfig(w io.Writer, fs *flag.FlagSet, sources map[string]string) error {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if !commandOnlyFlags[f.Name] {
+			names = append(names, f.Name)
+		}
+	})
+	sort.Strings(names)
+
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	for _, name := range names {
+		v := flagValue(fs.Lookup(name))
+		if secretFlags[name] && v != "" {
+			v = "******"
+		}
+		value := &yaml.Node{}
+		if err := value.Encode(v); err != nil {
+			return err
+		}
+		value.LineComment = sources[name]
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// flagValue 返回参数的当前值，时长按 5s、1m0s 的形式输出
+func flagValue(f *flag.Flag) any {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return f.Value.String()
+	}
+	switch v := getter.Get().(type) {
+	case time.Duration:
+		return v.String()
+	default:
+		return v
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// testFlagSet 返回与 main 中同名的一组参数
+func testFlagSet(args ...string) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", "", "")
+	fs.Duration("geo-timeout", 5*time.Second, "")
+	fs.Int("geo-max-failures", 3, "")
+	fs.Int("cache-size", 10000, "")
+	fs.String("lang", "zh", "")
+	fs.String("theme", "dark", "")
+	fs.String("geodb", "", "")
+	fs.Float64("rate-limit", 5, "")
+	fs.Bool("access-log", true, "")
+	fs.String("ipinfo-token", "", "")
+	if err := fs.Parse(args); err != nil {
+		panic(err)
+	}
+	return fs
+}
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestApplyConfigLayering(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+geo:
+  timeout: 3s
+cache-size: 100
+lang: en
+theme: light
+`)
+	t.Setenv("IP_CACHE_SIZE", "200")
+	t.Setenv("IP_LANG", "ru")
+	t.Setenv("IP_THEME", "")
+
+	fs := testFlagSet("-lang=ja")
+	sources, err := applyConfig(fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, value, source string
+	}{
+		{"geo-timeout", "3s", sourceFile},     // 只在配置文件中
+		{"cache-size", "200", sourceEnv},      // 环境变量覆盖配置文件
+		{"lang", "ja", sourceFlag},            // 命令行参数覆盖环境变量和配置文件
+		{"theme", "light", sourceFile},        // 空的环境变量不覆盖配置文件
+		{"access-log", "true", sourceDefault}, // 都没有设置
+	}
+	for _, tt := range tests {
+		if got := fs.Lookup(tt.name).Value.String(); got != tt.value || sources[tt.name] != tt.source {
+			t.Errorf("%s = %s（%s），期望 %s（%s）", tt.name, got, sources[tt.name], tt.value, tt.source)
+		}
+	}
+}
+
+func TestApplyConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content, env, want string
+	}{
+		{"未知的配置项", "c.yaml", "geo:\n  timeot: 3s\n", "", "未知的配置项 geo-timeot"},
+		{"只在命令行使用的参数", "c.yaml", "config: other.yaml\n", "", "未知的配置项 config"},
+		{"配置文件的值无效", "c.json", `{"cache-size": "many"}`, "", "配置项 cache-size="},
+		{"环境变量的值无效", "c.toml", "", "IP_GEO_TIMEOUT=soon", "环境变量 IP_GEO_TIMEOUT="},
+		{"不支持的格式", "c.ini", "", "", "不支持的配置文件格式"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if k, v, ok := strings.Cut(tt.env, "="); ok {
+				t.Setenv(k, v)
+			}
+			_, err := applyConfig(testFlagSet(), writeConfig(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误 %v，期望包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigFileFormats(t *testing.T) {
+	want := map[string]string{
+		"geo-timeout":      "3s",
+		"geo-max-failures": "5",
+		"geodb":            "City.mmdb,ASN.mmdb",
+		"rate-limit":       "2.5",
+		"access-log":       "false",
+		"ipinfo-token":     "",
+	}
+	files := map[string]string{
+		"config.yaml": `
+geo:
+  timeout: 3s
+  max_failures: 5
+geodb: [City.mmdb, ASN.mmdb]
+rate-limit: 2.5
+Access_Log: false
+ipinfo-token:
+`,
+		"config.json": `{
+  "geo": {"timeout": "3s", "max_failures": 5},
+  "geodb": ["City.mmdb", "ASN.mmdb"],
+  "rate-limit": 2.5,
+  "Access_Log": false,
+  "ipinfo-token": null
+}`,
+		"config.toml": `
+geodb = ["City.mmdb", "ASN.mmdb"]
+rate-limit = 2.5
+Access_Log = false
+ipinfo-token = ""
+
+[geo]
+timeout = "3s"
+max_failures = 5
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			got, err := readConfigFile(writeConfig(t, name, content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, want) {
+				t.Errorf("展开结果 %v，期望 %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPrintConfigMasksSecrets(t *testing.T) {
+	t.Setenv("IP_GEO_TIMEOUT", "3s")
+	fs := testFlagSet("-ipinfo-token=secret-token")
+	sources, err := applyConfig(fs, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := printConfig(&buf, fs, sources); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "secret-token") {
+		t.Fatalf("输出中包含密钥:\n%s", out)
+	}
+
+	var printed map[string]any
+	if err := yaml.Unmarshal(buf.Bytes(), &printed); err != nil {
+		t.Fatalf("输出不是有效的 YAML: %v\n%s", err, out)
+	}
+	if printed["ipinfo-token"] != "******" || printed["geo-timeout"] != "3s" {
+		t.Errorf("输出的值不正确: %v", printed)
+	}
+	if _, ok := printed["config"]; ok {
+		t.Error("不应输出只在命令行使用的参数")
+	}
+	for _, line := range []string{"geo-timeout: 3s # env", "# flag", "lang: zh # default"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("输出中缺少 %q:\n%s", line, out)
+		}
+	}
+}
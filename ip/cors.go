@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// SetCORSOrigins 设置允许跨域访问的来源，如 https://example.com，包含 * 或为空时允许所有来源
+func (s *Server) SetCORSOrigins(origins []string) {
+	s.corsOrigins = nil
+	for _, o := range origins {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o == "*" {
+			s.corsOrigins = nil
+			return
+		}
+		if o != "" {
+			s.corsOrigins = append(s.corsOrigins, o)
+		}
+	}
+}
+
+// setCORSHeaders 允许所有来源时返回 *，否则只对列表中的来源返回其本身，
+// 此时响应随 Origin 变化
+func (s *Server) setCORSHeaders(r *http.Request, h http.Header) {
+	if len(s.corsOrigins) == 0 {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if !slices.Contains(s.corsOrigins, origin) {
+			return
+		}
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	h.Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", "Accept, Content-Type")
+}
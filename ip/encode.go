@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ImageOptions 位图编码配置
+type ImageOptions struct {
+	JPEGQuality    int                  // JPEG 默认质量，1～100，请求可通过 ?quality= 覆盖
+	GIFColors      int                  // GIF 调色板颜色数，2～256，包含透明色
+	PNGCompression png.CompressionLevel // PNG 压缩级别
+	PNGBufferPool  bool                 // 复用 PNG 编码器的缓冲区
+}
+
+func defaultImageOptions() ImageOptions {
+	return ImageOptions{JPEGQuality: 90, GIFColors: 256, PNGCompression: png.DefaultCompression, PNGBufferPool: true}
+}
+
+// pngCompressionLevels -png-compression 的可选值
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"speed":   png.BestSpeed,
+	"best":    png.BestCompression,
+	"none":    png.NoCompression,
+}
+
+// ParsePNGCompression 解析 PNG 压缩级别，可选 default、speed、best、none
+func ParsePNGCompression(name string) (png.CompressionLevel, error) {
+	level, ok := pngCompressionLevels[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, fmt.Errorf("未知的 PNG 压缩级别: %s，可选 default,speed,best,none", name)
+	}
+	return level, nil
+}
+
+// pngBufferPool 在请求之间复用 PNG 编码器的行缓冲区和 zlib 写入器
+type pngBufferPool struct {
+	pool sync.Pool
+}
+
+func (p *pngBufferPool) Get() *png.EncoderBuffer {
+	b, _ := p.pool.Get().(*png.EncoderBuffer)
+	return b
+}
+
+func (p *pngBufferPool) Put(b *png.EncoderBuffer) {
+	p.pool.Put(b)
+}
+
+func newPNGEncoder(opts ImageOptions) *png.Encoder {
+	enc := &png.Encoder{CompressionLevel: opts.PNGCompression}
+	if opts.PNGBufferPool {
+		enc.BufferPool = &pngBufferPool{}
+	}
+	return enc
+}
+
+// SetupImage 设置位图编码参数
+func (s *Server) SetupImage(opts ImageOptions) error {
+	if opts.JPEGQuality < 1 || opts.JPEGQuality > 100 {
+		return fmt.Errorf("JPEG 质量应在 1～100 之间: %d", opts.JPEGQuality)
+	}
+	if opts.GIFColors < 2 || opts.GIFColors > 256 {
+		return fmt.Errorf("GIF 颜色数应在 2～256 之间: %d", opts.GIFColors)
+	}
+	s.imageOpts = opts
+	s.pngEncoder = newPNGEncoder(opts)
+	return nil
+}
+
+// encodeImage 按输出格式编码位图，quality 只对 JPEG 有效，WebP 为无损编码
+func (s *Server) encodeImage(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case formatJPEG:
+		// JPEG 没有透明通道，圆角外的透明区域填充为白色
+		return jpeg.Encode(w, flatten(img, color.White), &jpeg.Options{Quality: quality})
+	case formatGIF:
+		return gif.Encode(w, quantize(img, s.imageOpts.GIFColors), nil)
+	case formatWebP:
+		return encodeWebP(w, img)
+	default:
+		return s.pngEncoder.Encode(w, img)
+	}
+}
+
+// flatten 将图像合成到纯色背景上
+func flatten(img image.Image, bg color.Color) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
+
+// colorCount 直方图中的一种颜色
+type colorCount struct {
+	c [3]uint8
+	n int
+}
+
+// quantize 用中位切分法为 GIF 生成调色板。GIF 只有 1 位透明度，
+// 透明度低于一半的像素使用透明色，其余按不透明处理；卡片颜色较少，不做抖动
+func quantize(img image.Image, colors int) *image.Paletted {
+	b := img.Bounds()
+	pix := make([]color.NRGBA, 0, b.Dx()*b.Dy())
+	counts := make(map[[3]uint8]int)
+	transparent := false
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			pix = append(pix, c)
+			if c.A < 0x80 {
+				transparent = true
+				continue
+			}
+			counts[[3]uint8{c.R, c.G, c.B}]++
+		}
+	}
+
+	var palette color.Palette
+	if transparent {
+		palette = append(palette, color.Transparent)
+		colors--
+	}
+	hist := make([]colorCount, 0, len(counts))
+	for c, n := range counts {
+		hist = append(hist, colorCount{c, n})
+	}
+	palette = append(palette, medianCut(hist, colors)...)
+	if len(palette) == 0 {
+		palette = append(palette, color.NRGBA{A: 0xff})
+	}
+
+	dst := image.NewPaletted(b, palette)
+	cache := make(map[color.NRGBA]uint8)
+	i := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := pix[i]
+			i++
+			if c.A < 0x80 {
+				dst.SetColorIndex(x, y, 0)
+				continue
+			}
+			c.A = 0xff
+			idx, ok := cache[c]
+			if !ok {
+				idx = uint8(nearestColor(palette, c, transparent))
+				cache[c] = idx
+			}
+			dst.SetColorIndex(x, y, idx)
+		}
+	}
+	return dst
+}
+
+// nearestColor 返回调色板中与 c 距离最近的不透明颜色
+func nearestColor(palette color.Palette, c color.NRGBA, skipFirst bool) int {
+	best, bestDist := 0, -1
+	for i, p := range palette {
+		if i == 0 && skipFirst {
+			continue
+		}
+		pc := p.(color.NRGBA)
+		dr, dg, db := int(pc.R)-int(c.R), int(pc.G)-int(c.G), int(pc.B)-int(c.B)
+		if d := dr*dr + dg*dg + db*db; bestDist < 0 || d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// medianCut 每次选取颜色跨度最大的箱子，沿跨度最大的通道按像素数中位数切分，
+// 直到箱子数达到 n，每个箱子取加权平均色
+func medianCut(hist []colorCount, n int) color.Palette {
+	if len(hist) == 0 || n <= 0 {
+		return nil
+	}
+	boxes := [][]colorCount{hist}
+	for len(boxes) < n {
+		bi, channel, span := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if ch, sp := widestChannel(box); sp > span {
+				bi, channel, span = i, ch, sp
+			}
+		}
+		if bi < 0 {
+			break
+		}
+
+		box := boxes[bi]
+		sort.Slice(box, func(i, j int) bool { return box[i].c[channel] < box[j].c[channel] })
+		total := 0
+		for _, e := range box {
+			total += e.n
+		}
+		split, acc := 1, 0
+		for i, e := range box[:len(box)-1] {
+			acc += e.n
+			split = i + 1
+			if acc*2 >= total {
+				break
+			}
+		}
+		boxes[bi] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	palette := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var sum [3]int
+		total := 0
+		for _, e := range box {
+			for ch := range sum {
+				sum[ch] += int(e.c[ch]) * e.n
+			}
+			total += e.n
+		}
+		palette = append(palette, color.NRGBA{
+			R: uint8((sum[0] + total/2) / total),
+			G: uint8((sum[1] + total/2) / total),
+			B: uint8((sum[2] + total/2) / total),
+			A: 0xff,
+		})
+	}
+	return palette
+}
+
+func widestChannel(box []colorCount) (int, int) {
+	channel, span := 0, 0
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := 255, 0
+		for _, e := range box {
+			lo, hi = min(lo, int(e.c[ch])), max(hi, int(e.c[ch]))
+		}
+		if hi-lo > span {
+			channel, span = ch, hi-lo
+		}
+	}
+	return channel, span
+}
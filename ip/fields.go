@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// cardField 卡片上可选的一行内容
+type cardField struct {
+	label func(m *messages) string
+	value func(d cardData) string
+	icon  func(d cardData) string // 文字前的图标，见 deviceIcons
+	wide  bool                    // 占满整行，排在 logo 下方
+}
+
+var cardFields = map[string]cardField{
+	"ip": {
+		label: func(m *messages) string { return m.YourIP },
+		value: func(d cardData) string { return d.IP },
+	},
+	"time": {
+		label: func(m *messages) string { return m.Time },
+		value: func(d cardData) string { return d.Now },
+	},
+	"region": {
+		label: func(m *messages) string { return m.Region },
+		value: func(d cardData) string { return d.Loc },
+	},
+	"isp": {
+		label: func(m *messages) string { return m.ISP },
+		value: func(d cardData) string {
+			if d.Geo == nil {
+				return ""
+			}
+			return d.Geo.ISP
+		},
+	},
+	"org": {
+		label: func(m *messages) string { return m.Org },
+		value: func(d cardData) string {
+			// 与运营商相同时不重复显示
+			if d.Geo == nil || d.Geo.Org == d.Geo.ISP {
+				return ""
+			}
+			return d.Geo.Org
+		},
+	},
+	"asn": {
+		label: func(m *messages) string { return "ASN" },
+		value: func(d cardData) string {
+			if d.Geo == nil || d.Geo.ASN == 0 {
+				return ""
+			}
+			return strings.TrimSpace(fmt.Sprintf("AS%d %s", d.Geo.ASN, d.Geo.ASName))
+		},
+	},
+	"coords": {
+		label: func(m *messages) string { return m.Coords },
+		value: func(d cardData) string {
+			if d.Geo == nil {
+				return ""
+			}
+			return formatCoords(d.Geo.Latitude, d.Geo.Longitude)
+		},
+	},
+	"tz": {
+		label: func(m *messages) string { return m.TimeZone },
+		value: func(d cardData) string {
+			if d.Geo == nil {
+				return ""
+			}
+			return d.Geo.TimeZone
+		},
+	},
+	"client": {
+		label: func(m *messages) string { return m.Client },
+		value: func(d cardData) string { return d.Client.Summary(d.Msg) },
+		icon:  func(d cardData) string { return d.Client.Device },
+	},
+	"ua": {
+		label: func(m *messages) string { return "UA" },
+		value: func(d cardData) string { return d.UA },
+		wide:  true,
+	},
+}
+
+// cardPreset 预设的字段和尺寸，Height 为 0 时按内容自动计算
+type cardPreset struct {
+	Fields []string
+	Width  float64
+	Height float64
+}
+
+var cardPresets = map[string]cardPreset{
+	"default":  {Fields: []string{"ip", "time", "region", "ua"}, Width: 600, Height: 200},
+	"compact":  {Fields: []string{"ip", "region"}, Width: 468, Height: 60},
+	"detailed": {Fields: []string{"ip", "time", "region", "isp", "org", "asn", "coords", "tz", "client", "ua"}, Width: 600},
+}
+
+// 卡片尺寸范围
+const (
+	minCardWidth  = 200
+	maxCardWidth  = 1200
+	minCardHeight = 40
+	maxCardHeight = 600
+)
+
+// cardOptions 通过 ?preset=、?fields=、?w=、?h= 指定的卡片内容和尺寸
+type cardOptions struct {
+	Fields []string
+	Width  float64
+	Height float64
+}
+
+// parseCardOptions 解析卡片参数，先取预设，再用 fields、w、h 覆盖；
+// 只指定 fields 时高度按内容自动计算
+func parseCardOptions(q url.Values) cardOptions {
+	preset, ok := cardPresets[q.Get("preset")]
+	if !ok {
+		preset = cardPresets["default"]
+		if q.Get("fields") != "" {
+			preset.Height = 0
+		}
+	}
+	opts := cardOptions{Fields: preset.Fields, Width: preset.Width, Height: preset.Height}
+
+	if spec := q.Get("fields"); spec != "" {
+		var fields []string
+		seen := make(map[string]bool)
+		for _, name := range strings.Split(spec, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if _, ok := cardFields[name]; ok && !seen[name] {
+				fields = append(fields, name)
+				seen[name] = true
+			}
+		}
+		if len(fields) > 0 {
+			opts.Fields = fields
+		}
+	}
+	if w, ok := parseDimension(q.Get("w")); ok {
+		opts.Width = min(max(w, minCardWidth), maxCardWidth)
+	}
+	if h, ok := parseDimension(q.Get("h")); ok {
+		opts.Height = min(max(h, minCardHeight), maxCardHeight)
+	}
+	return opts
+}
+
+// parseDimension 解析宽高参数。ParseFloat 接受 NaN 和 Inf，NaN 经过 min/max
+// 仍是 NaN，会使画布尺寸无效，这里一并拒绝
+func parseDimension(s string) (float64, bool) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// formatCoords 以 "35.6895°N, 139.6917°E" 的形式显示坐标
+func formatCoords(lat, lon float64) string {
+	if lat == 0 && lon == 0 {
+		return ""
+	}
+	ns, ew := "N", "E"
+	if lat < 0 {
+		ns = "S"
+	}
+	if lon < 0 {
+		ew = "W"
+	}
+	return fmt.Sprintf("%.4f°%s, %.4f°%s", math.Abs(lat), ns, math.Abs(lon), ew)
+}
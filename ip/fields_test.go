@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseCardOptionsDimensions(t *testing.T) {
+	def := parseCardOptions(url.Values{})
+	tests := []struct {
+		query         string
+		width, height float64
+	}{
+		{"w=400&h=200", 400, 200},
+		{"w=1&h=1", minCardWidth, minCardHeight},
+		{"w=100000&h=100000", maxCardWidth, maxCardHeight},
+		{"w=NaN&h=NaN", def.Width, def.Height},
+		{"w=nan&h=-nan", def.Width, def.Height},
+		{"w=Inf&h=-Inf", def.Width, def.Height},
+		{"w=abc", def.Width, def.Height},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		opts := parseCardOptions(q)
+		if opts.Width != tt.width || opts.Height != tt.height {
+			t.Errorf("%s: 尺寸为 %gx%g，期望 %gx%g", tt.query, opts.Width, opts.Height, tt.width, tt.height)
+		}
+	}
+}
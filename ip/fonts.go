@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// fontBuiltin 字体列表中代表内置 Go 字体的名称
+const fontBuiltin = "go"
+
+// embeddedFontDir 编译时放入该目录的字体会被内嵌，例如中文子集字体
+const embeddedFontDir = "assets/fonts"
+
+// fontChain 按顺序排列的字体，绘制时每个字符使用第一个包含该字形的字体
+type fontChain struct {
+	regular []*opentype.Font
+	bold    []*opentype.Font
+	missing map[string][]rune // 各语言卡片文字中所有字体都缺少的字形
+}
+
+func (s *Server) initFonts() {
+	if err := s.LoadFonts(nil); err != nil {
+		log.Printf("加载字体失败: %v", err)
+		s.fontErr = err
+	}
+}
+
+// LoadFonts 按顺序加载 TTF/OTF/TTC 字体文件，"go" 表示内置的 Go 字体。
+// 列表为空时使用 assets/fonts 中内嵌的字体；没有列出 "go" 时追加到最后兜底拉丁字符
+func (s *Server) LoadFonts(paths []string) error {
+	var names []string
+	for _, p := range paths {
+		if p = strings.TrimSpace(p); p != "" {
+			names = append(names, p)
+		}
+	}
+	if len(names) == 0 {
+		names = s.embeddedFonts()
+	}
+
+	hasBuiltin := false
+	for _, name := range names {
+		if name == fontBuiltin {
+			hasBuiltin = true
+		}
+	}
+	if !hasBuiltin {
+		names = append(names, fontBuiltin)
+	}
+
+	chain := &fontChain{}
+	for _, name := range names {
+		if name == fontBuiltin {
+			regular, err := opentype.Parse(goregular.TTF)
+			if err != nil {
+				return fmt.Errorf("解析内置字体失败: %w", err)
+			}
+			bold, err := opentype.Parse(gobold.TTF)
+			if err != nil {
+				return fmt.Errorf("解析内置粗体字体失败: %w", err)
+			}
+			chain.regular = append(chain.regular, regular)
+			chain.bold = append(chain.bold, bold)
+			continue
+		}
+
+		f, err := s.loadFontFile(name)
+		if err != nil {
+			return fmt.Errorf("加载字体 %s 失败: %w", name, err)
+		}
+		// 外部字体没有单独的粗体，粗体文字同样使用它
+		chain.regular = append(chain.regular, f)
+		chain.bold = append(chain.bold, f)
+		log.Printf("已加载字体: %s", name)
+	}
+
+	chain.missing = missingGlyphs(chain.regular)
+	s.fonts = chain
+	s.fontErr = nil
+	return nil
+}
+
+// missingGlyphs 返回各语言卡片文字中所有字体都缺少的字形
+func missingGlyphs(fonts []*opentype.Font) map[string][]rune {
+	var buf sfnt.Buffer
+	missing := make(map[string][]rune)
+	for lang, msg := range catalogs {
+		seen := make(map[rune]bool)
+		for _, text := range msg.texts() {
+			for _, r := range text {
+				if seen[r] || unicode.IsSpace(r) {
+					continue
+				}
+				seen[r] = true
+				if !hasGlyph(fonts, &buf, r) {
+					missing[lang] = append(missing[lang], r)
+				}
+			}
+		}
+	}
+	return missing
+}
+
+// rasterLang 返回位图卡片使用的语言。仓库不带中文字体，只有内置 Go 字体时
+// zh、ja 改用英文绘制，避免卡片上出现缺字方框；SVG 由浏览器使用系统字体，不受影响
+func (s *Server) rasterLang(lang string) string {
+	if s.fonts == nil || len(s.fonts.missing[lang]) == 0 || len(s.fonts.missing[fallbackLang]) > 0 {
+		return lang
+	}
+	return fallbackLang
+}
+
+// checkFontCoverage 检查字体是否包含默认语言卡片文字的全部字形
+func (s *Server) checkFontCoverage() error {
+	if s.fonts == nil {
+		return nil
+	}
+	if missing := s.fonts.missing[s.defaultLang]; len(missing) > 0 {
+		return fmt.Errorf("字体缺少语言 %s 的 %d 个字形: %s，位图卡片改用 %s",
+			s.defaultLang, len(missing), string(missing), s.rasterLang(s.defaultLang))
+	}
+	return nil
+}
+
+func hasGlyph(fonts []*opentype.Font, buf *sfnt.Buffer, r rune) bool {
+	for _, f := range fonts {
+		if idx, err := f.GlyphIndex(buf, r); err == nil && idx != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// embeddedFonts 返回内嵌字体的路径，以 embed: 前缀区分外部文件
+func (s *Server) embeddedFonts() []string {
+	entries, err := fs.ReadDir(s.assets, embeddedFontDir)
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && isFontFile(e.Name()) {
+			names = append(names, "embed:"+path.Join(embeddedFontDir, e.Name()))
+		}
+	}
+	return names
+}
+
+func isFontFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ttf", ".otf", ".ttc", ".otc":
+		return true
+	}
+	return false
+}
+
+func (s *Server) loadFontFile(name string) (*opentype.Font, error) {
+	var data []byte
+	var err error
+	if embedded, ok := strings.CutPrefix(name, "embed:"); ok {
+		data, err = s.assets.ReadFile(embedded)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ttc", ".otc":
+		// 字体集合只使用第一个字体
+		collection, err := opentype.ParseCollection(data)
+		if err != nil {
+			return nil, err
+		}
+		return collection.Font(0)
+	default:
+		return opentype.Parse(data)
+	}
+}
+
+// fallbackFace 由多个字体组成的 Face，每个字符使用第一个包含该字形的字体。
+// 与 opentype.Face 一样不能并发使用
+type fallbackFace struct {
+	fonts []*sfnt.Font
+	faces []font.Face
+	buf   sfnt.Buffer
+}
+
+func newFallbackFace(fonts []*opentype.Font, size float64) (*fallbackFace, error) {
+	f := &fallbackFace{}
+	for _, tt := range fonts {
+		face, err := opentype.NewFace(tt, &opentype.FaceOptions{
+			Size:    size,
+			DPI:     72,
+			Hinting: font.HintingFull,
+		})
+		if err != nil {
+			return nil, err
+		}
+		f.fonts = append(f.fonts, tt)
+		f.faces = append(f.faces, face)
+	}
+	if len(f.faces) == 0 {
+		return nil, fmt.Errorf("没有可用的字体")
+	}
+	return f, nil
+}
+
+// pick 返回包含该字符的字体序号，都不包含时使用第一个字体（显示缺字方框）
+func (f *fallbackFace) pick(r rune) int {
+	for i, tt := range f.fonts {
+		if idx, err := tt.GlyphIndex(&f.buf, r); err == nil && idx != 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.faces[f.pick(r)].GlyphAdvance(r)
+}
+
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	i := f.pick(r0)
+	if i != f.pick(r1) {
+		return 0
+	}
+	return f.faces[i].Kern(r0, r1)
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
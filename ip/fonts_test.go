@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckFontCoverage(t *testing.T) {
+	s, _ := testServer(t)
+
+	// 内置 Go 字体只有拉丁和西里尔字形
+	for _, lang := range []string{"en", "ru"} {
+		if err := s.SetDefaultLang(lang); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.checkFontCoverage(); err != nil {
+			t.Errorf("%s: 内置字体应包含全部字形: %v", lang, err)
+		}
+	}
+
+	if err := s.SetDefaultLang("zh"); err != nil {
+		t.Fatal(err)
+	}
+	err := s.checkFontCoverage()
+	if err == nil {
+		t.Fatal("内置字体没有中文字形，应返回错误")
+	}
+	if msg := err.Error(); !strings.Contains(msg, "您") || strings.Contains(msg, "IP") || !strings.Contains(msg, "改用 en") {
+		t.Errorf("应只列出缺少的字形: %v", err)
+	}
+}
+
+func TestRasterLang(t *testing.T) {
+	s, _ := testServer(t)
+	tests := map[string]string{"zh": "en", "ja": "en", "en": "en", "ru": "ru"}
+	for lang, want := range tests {
+		if got := s.rasterLang(lang); got != want {
+			t.Errorf("内置字体 rasterLang(%s) = %s，期望 %s", lang, got, want)
+		}
+	}
+
+	// 英文也画不出时保持原语言
+	s.fonts = &fontChain{missing: map[string][]rune{"zh": []rune("您"), "en": []rune("Y")}}
+	if got := s.rasterLang("zh"); got != "zh" {
+		t.Errorf("rasterLang(zh) = %s，期望 zh", got)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 输出格式
+const (
+	formatSVG  = "svg"
+	formatPNG  = "png"
+	formatJPEG = "jpg"
+	formatGIF  = "gif"
+	formatWebP = "webp"
+	formatJSON = "json"
+	formatText = "txt"
+	formatANSI = "ansi"
+)
+
+// formatAliases 格式的其他写法
+var formatAliases = map[string]string{"jpeg": formatJPEG}
+
+// formatTypes 各格式的 MIME 类型，顺序即 Accept 权重相同时的优先顺序
+var formatTypes = []struct {
+	format   string
+	mimeType string
+}{
+	{formatSVG, "image/svg+xml"},
+	{formatPNG, "image/png"},
+	{formatJSON, "application/json"},
+	{formatText, "text/plain"},
+	{formatWebP, "image/webp"},
+	{formatJPEG, "image/jpeg"},
+	{formatGIF, "image/gif"},
+}
+
+// rasterFormats 由位图渲染器生成的格式
+var rasterFormats = map[string]bool{formatPNG: true, formatJPEG: true, formatGIF: true, formatWebP: true}
+
+// terminalClients 命令行工具的 UA 前缀，这些客户端默认返回 ANSI 文本卡片
+var terminalClients = []string{"curl/", "wget/", "httpie/", "xh/"}
+
+// lookupFormat 将格式名或别名转换为输出格式
+func lookupFormat(name string) (string, bool) {
+	if alias, ok := formatAliases[name]; ok {
+		name = alias
+	}
+	if name == formatANSI {
+		return name, true
+	}
+	for _, t := range formatTypes {
+		if t.format == name {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// mimeType 返回格式的 MIME 类型
+func mimeType(format string) string {
+	for _, t := range formatTypes {
+		if t.format == format {
+			return t.mimeType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// negotiateFormat 选择输出格式，优先级：?format= 参数 > 路径后缀 >
+// 命令行工具且 Accept 没有明确类型时返回 ANSI > Accept 协商，默认 SVG。
+// 浏览器的 Accept 普遍列出 image/webp、image/avif，只表示能解码，不代表比 SVG 更合适，
+// 因此只在协商结果原本是 PNG/JPEG/GIF 等位图、或没有其他可接受的格式时才换成 WebP，
+// 明确接受 image/svg+xml 的浏览器仍然得到 SVG。没有 AVIF 编码器，支持 AVIF 的浏览器都支持 WebP
+func negotiateFormat(r *http.Request) string {
+	if format, ok := formatFromURL(r); ok {
+		return format
+	}
+
+	ranges := parseAccept(r.Header.Get("Accept"))
+	if isTerminalClient(r.UserAgent()) && isGenericAccept(ranges) {
+		return formatANSI
+	}
+	if len(ranges) == 0 {
+		return formatSVG
+	}
+
+	best, bestQ := formatSVG, 0.0
+	for _, t := range formatTypes {
+		if t.format == formatWebP {
+			continue
+		}
+		if q := acceptQuality(ranges, t.mimeType); q > bestQ {
+			best, bestQ = t.format, q
+		}
+	}
+	webpQ := max(explicitQuality(ranges, "image/webp"), explicitQuality(ranges, "image/avif"))
+	if webpQ > 0 && (bestQ == 0 || rasterFormats[best] && webpQ >= bestQ) {
+		return formatWebP
+	}
+	return best
+}
+
+// 位图输出的最大缩放倍数
+const maxScale = 3
+
+// negotiateScale 位图的像素密度，优先取 ?scale= 参数，其次取
+// /api/ip@2x.png 这类路径中的倍数，无效时为 1
+func negotiateScale(r *http.Request) int {
+	spec := r.URL.Query().Get("scale")
+	if spec == "" {
+		name := strings.TrimSuffix(path.Base(r.URL.Path), path.Ext(r.URL.Path))
+		if i := strings.LastIndexByte(name, '@'); i >= 0 {
+			spec = strings.TrimSuffix(name[i+1:], "x")
+		}
+	}
+	if n, err := strconv.Atoi(spec); err == nil && n >= 1 && n <= maxScale {
+		return n
+	}
+	return 1
+}
+
+// formatFromURL 返回 ?format= 参数或路径后缀指定的格式
+func formatFromURL(r *http.Request) (string, bool) {
+	if format, ok := lookupFormat(strings.ToLower(r.URL.Query().Get("format"))); ok {
+		return format, true
+	}
+	return lookupFormat(strings.TrimPrefix(path.Ext(r.URL.Path), "."))
+}
+
+// negotiateQuality 有损格式的质量，?quality= 无效时使用 def
+func negotiateQuality(r *http.Request, def int) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get("quality")); err == nil && n >= 1 && n <= 100 {
+		return n
+	}
+	return def
+}
+
+func isTerminalClient(ua string) bool {
+	ua = strings.ToLower(ua)
+	for _, prefix := range terminalClients {
+		if strings.HasPrefix(ua, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGenericAccept Accept 为空或只包含 */*、text/* 这类通配类型
+func isGenericAccept(ranges []acceptRange) bool {
+	for _, r := range ranges {
+		if r.mimeType != "*/*" && r.mimeType != "text/*" {
+			return false
+		}
+	}
+	return true
+}
+
+type acceptRange struct {
+	mimeType string
+	q        float64
+}
+
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mimeType := strings.ToLower(strings.TrimSpace(fields[0]))
+		if mimeType == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.TrimSpace(key) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		ranges = append(ranges, acceptRange{mimeType: mimeType, q: q})
+	}
+	return ranges
+}
+
+// acceptQuality 返回 mimeType 在 Accept 中最具体的匹配项的权重，未匹配时为 0
+func acceptQuality(ranges []acceptRange, mimeType string) float64 {
+	major, _, _ := strings.Cut(mimeType, "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		var s int
+		switch r.mimeType {
+		case mimeType:
+			s = 2
+		case major + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// explicitQuality 返回 Accept 中明确列出 mimeType 时的权重，通配类型不算
+func explicitQuality(ranges []acceptRange, mimeType string) float64 {
+	for _, r := range ranges {
+		if r.mimeType == mimeType {
+			return r.q
+		}
+	}
+	return 0
+}
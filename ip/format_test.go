@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	const chromeUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/129.0.0.0 Safari/537.36"
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		ua     string
+		want   string
+	}{
+		{"Chrome 图片请求", "/api/ip", "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8", chromeUA, formatSVG},
+		{"Chrome 页面请求", "/api/ip", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7", chromeUA, formatSVG},
+		{"Firefox 图片请求", "/api/ip", "image/avif,image/webp,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5", "", formatSVG},
+		{"Safari 图片请求", "/api/ip", "image/webp,image/avif,image/jxl,image/heic,image/heic-sequence,video/*;q=0.8,image/png,image/svg+xml,image/*;q=0.8,*/*;q=0.5", "", formatSVG},
+		{"没有 Accept", "/api/ip", "", "", formatSVG},
+		{"通配", "/api/ip", "*/*", "", formatSVG},
+		{"原本为 PNG 时换成 WebP", "/api/ip", "image/png,image/webp", "", formatWebP},
+		{"WebP 权重较低", "/api/ip", "image/png,image/webp;q=0.5", "", formatPNG},
+		{"只接受 WebP", "/api/ip", "image/webp", "", formatWebP},
+		{"只接受 AVIF", "/api/ip", "image/avif", "", formatWebP},
+		{"SVG 权重较低时选位图", "/api/ip", "image/svg+xml;q=0.5,image/png", "", formatPNG},
+		{"JSON", "/api/ip", "application/json", "", formatJSON},
+		{"命令行工具", "/api/ip", "*/*", "curl/8.5.0", formatANSI},
+		{"命令行工具指定类型", "/api/ip", "application/json", "curl/8.5.0", formatJSON},
+		{"路径后缀优先", "/api/ip.png", "image/webp", "", formatPNG},
+		{"format 参数优先", "/api/ip.png?format=webp", "image/svg+xml", "", formatWebP},
+		{"jpeg 别名", "/api/ip?format=jpeg", "", "", formatJPEG},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			r.Header.Set("User-Agent", tt.ua)
+			if got := negotiateFormat(r); got != tt.want {
+				t.Errorf("negotiateFormat = %s，期望 %s", got, tt.want)
+			}
+		})
+	}
+}
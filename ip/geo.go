@@ -0,0 +1,571 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// GeoInfo 统一的地理位置查询结果
+type GeoInfo struct {
+	Country   string  `json:"country"`
+	Region    string  `json:"region"`
+	City      string  `json:"city"`
+	ISP       string  `json:"isp,omitempty"`
+	Org       string  `json:"org,omitempty"`
+	ASN       int     `json:"asn,omitempty"`
+	ASName    string  `json:"as_name,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	Loc       string  `json:"loc,omitempty"`
+	TimeZone  string  `json:"timezone,omitempty"`
+	Source    string  `json:"source,omitempty"`
+	// Names 数据源提供的本地化名称，键为卡片语言（zh、en、ja、ru）
+	Names map[string]GeoNames `json:"names,omitempty"`
+}
+
+// GeoNames 某种语言下的国家、地区、城市名称
+type GeoNames struct {
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+// Location 返回 "国家 地区 城市" 格式的地区描述
+func (g *GeoInfo) Location() string {
+	return joinLocation(g.Country, g.Region, g.City)
+}
+
+// normalize 补全各数据源缺少的字段：从 "AS15169 Google LLC" 格式的
+// org 中拆出 ASN，没有运营商时使用组织名称，坐标与 loc 互相补全
+func (g *GeoInfo) normalize() {
+	if g.ASN == 0 {
+		if asn, name := splitASN(g.Org); asn != 0 {
+			g.ASN, g.ASName, g.Org = asn, name, name
+		}
+	}
+	if g.Org == "" {
+		g.Org = g.ASName
+	}
+	if g.ISP == "" {
+		g.ISP = g.Org
+	}
+	if g.Latitude == 0 && g.Longitude == 0 {
+		g.Latitude, g.Longitude = parseLoc(g.Loc)
+	}
+	if g.Loc == "" {
+		g.Loc = formatLoc(g.Latitude, g.Longitude)
+	}
+}
+
+// GeoProvider 地理位置数据源。IP 不在数据源中时返回 nil, nil，
+// 查询出错（网络、限流、解析失败）时返回 error
+type GeoProvider interface {
+	Name() string
+	Lookup(ctx context.Context, ip string) (*GeoInfo, error)
+}
+
+// GeoOptions 地理位置数据源配置
+type GeoOptions struct {
+	Providers   []string          // 按顺序尝试的数据源名称
+	IPInfoToken string            // ipinfo.io API token
+	HTTPURL     string            // 通用 JSON 数据源地址，{ip} 会被替换为查询的 IP
+	HTTPFields  map[string]string // 通用 JSON 数据源字段映射，如 country=data.country_code
+	Cooldown    time.Duration     // 连续失败后跳过数据源的时间
+	MaxFailures int               // 连续失败多少次后进入冷却
+	Timeout     time.Duration     // 单次查询的超时时间
+}
+
+const (
+	providerIPInfo  = "ipinfo"
+	providerIPAPI   = "ip-api"
+	providerIPAPICo = "ipapi.co"
+	providerMMDB    = "mmdb"
+	providerHTTP    = "http"
+)
+
+func (s *Server) newGeoProvider(name string, opts GeoOptions) (GeoProvider, error) {
+	switch name {
+	case providerIPInfo:
+		return &ipinfoProvider{client: s.httpClient, token: opts.IPInfoToken}, nil
+	case providerIPAPI:
+		return &ipAPIProvider{client: s.httpClient}, nil
+	case providerIPAPICo:
+		return &ipapiCoProvider{client: s.httpClient}, nil
+	case providerMMDB:
+		if len(s.geoDB) == 0 {
+			return nil, errors.New("未加载本地数据库，请先指定 -geodb")
+		}
+		return &mmdbProvider{db: s.geoDB}, nil
+	case providerHTTP:
+		if opts.HTTPURL == "" {
+			return nil, errors.New("未配置通用数据源地址")
+		}
+		if len(opts.HTTPFields) == 0 {
+			return nil, errors.New("未配置通用数据源字段映射")
+		}
+		return &httpJSONProvider{client: s.httpClient, url: opts.HTTPURL, fields: opts.HTTPFields}, nil
+	default:
+		return nil, fmt.Errorf("未知的地理位置数据源: %s", name)
+	}
+}
+
+// SetupGeo 按配置顺序创建地理位置数据源链
+func (s *Server) SetupGeo(opts GeoOptions) error {
+	var providers []GeoProvider
+	for _, name := range opts.Providers {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		p, err := s.newGeoProvider(name, opts)
+		if err != nil {
+			return err
+		}
+		providers = append(providers, p)
+	}
+	if len(providers) == 0 {
+		return errors.New("至少需要一个地理位置数据源")
+	}
+
+	s.geo = newGeoChain(providers, opts.Cooldown, opts.MaxFailures)
+	s.geo.budget = s.geoBudget
+	s.geo.metrics = s.metrics
+	if opts.Timeout > 0 {
+		s.geoTimeout = opts.Timeout
+	}
+	log.Printf("地理位置数据源: %s", strings.Join(s.geo.names(), " → "))
+	return nil
+}
+
+// ParseFieldMap 解析 "country=data.country,city=data.city" 格式的字段映射
+func ParseFieldMap(spec string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, path, ok := strings.Cut(pair, "=")
+		if !ok || key == "" || path == "" {
+			return nil, fmt.Errorf("无效的字段映射: %s", pair)
+		}
+		fields[strings.TrimSpace(key)] = strings.TrimSpace(path)
+	}
+	return fields, nil
+}
+
+// geoChain 按顺序尝试各数据源，连续失败的数据源在冷却期内被跳过
+type geoChain struct {
+	providers   []*providerState
+	cooldown    time.Duration
+	maxFailures int
+	budget      *rate.Limiter // 在线数据源的查询预算，nil 为不限制
+	metrics     *metrics
+	now         func() time.Time // 判断冷却期使用的时钟，测试时替换
+}
+
+type providerState struct {
+	GeoProvider
+	mu            sync.Mutex
+	failures      int
+	disabledUntil time.Time
+}
+
+func newGeoChain(providers []GeoProvider, cooldown time.Duration, maxFailures int) *geoChain {
+	if maxFailures <= 0 {
+		maxFailures = 1
+	}
+	c := &geoChain{cooldown: cooldown, maxFailures: maxFailures, now: time.Now}
+	for _, p := range providers {
+		c.providers = append(c.providers, &providerState{GeoProvider: p})
+	}
+	return c
+}
+
+func (c *geoChain) names() []string {
+	names := make([]string, len(c.providers))
+	for i, p := range c.providers {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// Lookup 依次查询数据源，返回第一个有结果的数据源的结果
+func (c *geoChain) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	var lastErr error
+	for _, p := range c.providers {
+		if !p.available(c.now()) {
+			continue
+		}
+		// 预算用完时跳过在线数据源，本地数据库仍然可以查询
+		if c.budget != nil && isRemoteProvider(p.GeoProvider) && !c.budget.Allow() {
+			if c.metrics != nil {
+				c.metrics.budgetSkipped.Add(1)
+			}
+			lastErr = errGeoBudget
+			continue
+		}
+
+		start := time.Now()
+		info, err := p.Lookup(ctx, ip)
+		if c.metrics != nil {
+			c.metrics.observeLookup(p.Name(), time.Since(start), err)
+		}
+		if err != nil {
+			log.Printf("地理位置数据源 %s 查询失败: %v", p.Name(), err)
+			p.fail(c.now(), c.cooldown, c.maxFailures)
+			lastErr = err
+			continue
+		}
+		p.succeed()
+
+		if info != nil && info.Location() != "" {
+			info.normalize()
+			info.Source = p.Name()
+			return info, nil
+		}
+	}
+
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, nil
+}
+
+func (p *providerState) available(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return now.After(p.disabledUntil)
+}
+
+func (p *providerState) fail(now time.Time, cooldown time.Duration, maxFailures int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failures++
+	if p.failures >= maxFailures && cooldown > 0 {
+		p.disabledUntil = now.Add(cooldown)
+		p.failures = 0
+		log.Printf("地理位置数据源 %s 连续失败 %d 次，暂停使用 %s", p.Name(), maxFailures, cooldown)
+	}
+}
+
+func (p *providerState) succeed() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = 0
+}
+
+// fetchJSON 请求 JSON 接口并解析到 v
+func fetchJSON(ctx context.Context, client *http.Client, url string, header http.Header, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for k, vals := range header {
+		req.Header[k] = vals
+	}
+	req.Header.Set("User-Agent", "iptracker/2.0")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("返回状态码: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("解析响应失败: %w", err)
+	}
+	return nil
+}
+
+type ipInfo struct {
+	IP       string `json:"ip"`
+	City     string `json:"city"`
+	Region   string `json:"region"`
+	Country  string `json:"country"`
+	Org      string `json:"org"`
+	Loc      string `json:"loc"`
+	Timezone string `json:"timezone"`
+	Bogon    bool   `json:"bogon"`
+}
+
+// ipinfoProvider ipinfo.io，未配置 token 时使用免费额度
+type ipinfoProvider struct {
+	client *http.Client
+	token  string
+}
+
+func (p *ipinfoProvider) Name() string { return providerIPInfo }
+
+func (p *ipinfoProvider) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	header := make(http.Header)
+	if p.token != "" {
+		header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	var info ipInfo
+	if err := fetchJSON(ctx, p.client, fmt.Sprintf("https://ipinfo.io/%s/json", url.PathEscape(ip)), header, &info); err != nil {
+		return nil, err
+	}
+	if info.Bogon {
+		return nil, nil
+	}
+	return &GeoInfo{
+		Country:  info.Country,
+		Region:   info.Region,
+		City:     info.City,
+		Org:      info.Org,
+		Loc:      info.Loc,
+		TimeZone: info.Timezone,
+	}, nil
+}
+
+// ipAPIProvider ip-api.com，免费接口仅支持 HTTP
+type ipAPIProvider struct {
+	client *http.Client
+}
+
+func (p *ipAPIProvider) Name() string { return providerIPAPI }
+
+func (p *ipAPIProvider) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	var info struct {
+		Status      string  `json:"status"`
+		Message     string  `json:"message"`
+		CountryCode string  `json:"countryCode"`
+		RegionName  string  `json:"regionName"`
+		City        string  `json:"city"`
+		ISP         string  `json:"isp"`
+		Org         string  `json:"org"`
+		AS          string  `json:"as"`
+		Lat         float64 `json:"lat"`
+		Lon         float64 `json:"lon"`
+		Timezone    string  `json:"timezone"`
+	}
+	u := fmt.Sprintf("http://ip-api.com/json/%s?fields=status,message,countryCode,regionName,city,isp,org,as,lat,lon,timezone", url.PathEscape(ip))
+	if err := fetchJSON(ctx, p.client, u, nil, &info); err != nil {
+		return nil, err
+	}
+	if info.Status != "success" {
+		// 保留地址、无效查询等不算数据源故障
+		if info.Message == "private range" || info.Message == "reserved range" || info.Message == "invalid query" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询失败: %s", info.Message)
+	}
+
+	asn, asName := splitASN(info.AS)
+	return &GeoInfo{
+		Country:   info.CountryCode,
+		Region:    info.RegionName,
+		City:      info.City,
+		ISP:       info.ISP,
+		Org:       info.Org,
+		ASN:       asn,
+		ASName:    asName,
+		Latitude:  info.Lat,
+		Longitude: info.Lon,
+		TimeZone:  info.Timezone,
+	}, nil
+}
+
+// ipapiCoProvider ipapi.co
+type ipapiCoProvider struct {
+	client *http.Client
+}
+
+func (p *ipapiCoProvider) Name() string { return providerIPAPICo }
+
+func (p *ipapiCoProvider) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	var info struct {
+		Error       bool    `json:"error"`
+		Reason      string  `json:"reason"`
+		Reserved    bool    `json:"reserved"`
+		CountryCode string  `json:"country_code"`
+		Region      string  `json:"region"`
+		City        string  `json:"city"`
+		Org         string  `json:"org"`
+		ASN         string  `json:"asn"`
+		Latitude    float64 `json:"latitude"`
+		Longitude   float64 `json:"longitude"`
+		Timezone    string  `json:"timezone"`
+	}
+	if err := fetchJSON(ctx, p.client, fmt.Sprintf("https://ipapi.co/%s/json/", url.PathEscape(ip)), nil, &info); err != nil {
+		return nil, err
+	}
+	if info.Error {
+		if info.Reserved {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询失败: %s", info.Reason)
+	}
+
+	asn, _ := splitASN(info.ASN)
+	return &GeoInfo{
+		Country:   info.CountryCode,
+		Region:    info.Region,
+		City:      info.City,
+		Org:       info.Org,
+		ASN:       asn,
+		ASName:    info.Org,
+		Latitude:  info.Latitude,
+		Longitude: info.Longitude,
+		TimeZone:  info.Timezone,
+	}, nil
+}
+
+// mmdbProvider 本地 MMDB 数据库
+type mmdbProvider struct {
+	db geoDBs
+}
+
+func (p *mmdbProvider) Name() string { return providerMMDB }
+
+func (p *mmdbProvider) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	record, err := p.db.lookup(ip)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	info := &GeoInfo{
+		Country:   record.Country.ISOCode,
+		City:      record.City.Names["en"],
+		ASN:       int(record.ASN),
+		ASName:    record.ASOrg,
+		Latitude:  record.Location.Latitude,
+		Longitude: record.Location.Longitude,
+		TimeZone:  record.Location.TimeZone,
+	}
+	if len(record.Subdivisions) > 0 {
+		info.Region = record.Subdivisions[0].Names["en"]
+	}
+	for key, lang := range mmdbLangs {
+		names := GeoNames{
+			Country: record.Country.Names[key],
+			City:    record.City.Names[key],
+		}
+		if len(record.Subdivisions) > 0 {
+			names.Region = record.Subdivisions[0].Names[key]
+		}
+		if names != (GeoNames{}) {
+			if info.Names == nil {
+				info.Names = make(map[string]GeoNames)
+			}
+			info.Names[lang] = names
+		}
+	}
+	return info, nil
+}
+
+// httpJSONProvider 通用 JSON-over-HTTP 数据源，通过字段映射从响应中取值，
+// 映射路径用 . 分隔嵌套字段，如 data.location.city
+type httpJSONProvider struct {
+	client *http.Client
+	url    string
+	fields map[string]string
+}
+
+func (p *httpJSONProvider) Name() string { return providerHTTP }
+
+func (p *httpJSONProvider) Lookup(ctx context.Context, ip string) (*GeoInfo, error) {
+	var body map[string]any
+	u := strings.ReplaceAll(p.url, "{ip}", url.PathEscape(ip))
+	if err := fetchJSON(ctx, p.client, u, nil, &body); err != nil {
+		return nil, err
+	}
+
+	get := func(key string) string {
+		path, ok := p.fields[key]
+		if !ok {
+			return ""
+		}
+		return jsonPathString(body, path)
+	}
+	info := &GeoInfo{
+		Country:  get("country"),
+		Region:   get("region"),
+		City:     get("city"),
+		ISP:      get("isp"),
+		Org:      get("org"),
+		Loc:      get("loc"),
+		TimeZone: get("timezone"),
+	}
+	if asn := get("asn"); asn != "" {
+		info.ASN, _ = splitASN(asn)
+		info.ASName = get("as_name")
+	}
+	if lat, lon := get("lat"), get("lon"); lat != "" && lon != "" {
+		info.Latitude, info.Longitude = parseLoc(lat + "," + lon)
+	}
+	return info, nil
+}
+
+func jsonPathString(v any, path string) string {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = m[key]
+	}
+
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return fmt.Sprintf("%g", val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// splitASN 将 "AS15169 Google LLC"、"AS15169" 或 "15169" 拆分为 ASN 和名称，
+// 不是 ASN 格式时返回 0 和原字符串
+func splitASN(org string) (int, string) {
+	first, rest, _ := strings.Cut(strings.TrimSpace(org), " ")
+	if len(first) > 2 && strings.EqualFold(first[:2], "AS") {
+		first = first[2:]
+	}
+	if asn, err := strconv.Atoi(first); err == nil && asn > 0 {
+		return asn, strings.TrimSpace(rest)
+	}
+	return 0, org
+}
+
+// parseLoc 解析 "纬度,经度" 格式的坐标，无法解析时返回 0, 0
+func parseLoc(loc string) (float64, float64) {
+	latStr, lonStr, ok := strings.Cut(loc, ",")
+	if !ok {
+		return 0, 0
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0
+	}
+	return lat, lon
+}
+
+func formatLoc(lat, lon float64) string {
+	if lat == 0 && lon == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.4f,%.4f", lat, lon)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestChain(t *testing.T, clock *fakeClock, cooldown time.Duration, maxFailures int, providers ...GeoProvider) *geoChain {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	c := newGeoChain(providers, cooldown, maxFailures)
+	c.now = clock.now
+	return c
+}
+
+func TestGeoChainOrder(t *testing.T) {
+	errDown := errors.New("connection refused")
+	tests := []struct {
+		name      string
+		first     *stubProvider
+		second    *stubProvider
+		want      string // 返回结果的数据源，空为没有结果
+		wantErr   error
+		wantCalls [2]int32
+	}{
+		{"第一个有结果时不查询后面的",
+			&stubProvider{name: "a", info: &GeoInfo{Country: "AU"}}, &stubProvider{name: "b", info: &GeoInfo{Country: "JP"}},
+			"a", nil, [2]int32{1, 0}},
+		{"出错时回退到下一个",
+			&stubProvider{name: "a", err: errDown}, &stubProvider{name: "b", info: &GeoInfo{Country: "JP"}},
+			"b", nil, [2]int32{1, 1}},
+		{"没有结果时回退到下一个",
+			&stubProvider{name: "a"}, &stubProvider{name: "b", info: &GeoInfo{Country: "JP"}},
+			"b", nil, [2]int32{1, 1}},
+		{"地区为空时回退到下一个",
+			&stubProvider{name: "a", info: &GeoInfo{ISP: "Example"}}, &stubProvider{name: "b", info: &GeoInfo{Country: "JP"}},
+			"b", nil, [2]int32{1, 1}},
+		{"都出错时返回最后的错误",
+			&stubProvider{name: "a", err: errors.New("timeout")}, &stubProvider{name: "b", err: errDown},
+			"", errDown, [2]int32{1, 1}},
+		{"都没有结果",
+			&stubProvider{name: "a"}, &stubProvider{name: "b"},
+			"", nil, [2]int32{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChain(t, newFakeClock(), time.Minute, 3, tt.first, tt.second)
+			info, err := c.Lookup(context.Background(), "203.0.113.9")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v，期望 %v", err, tt.wantErr)
+			}
+			switch {
+			case tt.want == "" && info != nil:
+				t.Errorf("不应有结果: %+v", info)
+			case tt.want != "" && (info == nil || info.Source != tt.want):
+				t.Errorf("结果 %+v，期望来自 %s", info, tt.want)
+			}
+			if calls := [2]int32{tt.first.calls.Load(), tt.second.calls.Load()}; calls != tt.wantCalls {
+				t.Errorf("调用次数 %v，期望 %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestGeoChainCooldown(t *testing.T) {
+	clock := newFakeClock()
+	dead := &stubProvider{name: "dead", err: errors.New("timeout")}
+	backup := &stubProvider{name: "backup", info: &GeoInfo{Country: "AU"}}
+	c := newTestChain(t, clock, time.Minute, 2, dead, backup)
+
+	lookup := func() {
+		t.Helper()
+		if info, err := c.Lookup(context.Background(), "203.0.113.9"); err != nil || info == nil || info.Source != "backup" {
+			t.Fatalf("应回退到 backup: %+v, %v", info, err)
+		}
+	}
+
+	// 连续失败 2 次后进入冷却，之后的查询不再等待它
+	lookup()
+	lookup()
+	lookup()
+	if n := dead.calls.Load(); n != 2 {
+		t.Errorf("冷却期内不应查询，共查询 %d 次", n)
+	}
+	if err := c.cooling(); err != nil {
+		t.Errorf("还有可用的数据源，不应报告全部冷却: %v", err)
+	}
+
+	clock.advance(30 * time.Second)
+	lookup()
+	if n := dead.calls.Load(); n != 2 {
+		t.Errorf("冷却未结束不应查询，共查询 %d 次", n)
+	}
+
+	// 冷却结束后重新查询，恢复后失败计数清零
+	clock.advance(31 * time.Second)
+	dead.err, dead.info = nil, &GeoInfo{Country: "JP"}
+	if info, _ := c.Lookup(context.Background(), "203.0.113.9"); info == nil || info.Source != "dead" {
+		t.Fatalf("冷却结束后应重新使用: %+v", info)
+	}
+	dead.err, dead.info = errors.New("timeout"), nil
+	lookup()
+	clock.advance(time.Second)
+	lookup()
+	if n := dead.calls.Load(); n != 5 {
+		t.Errorf("成功后失败计数应清零，共查询 %d 次，期望 5", n)
+	}
+	lookup()
+	if n := dead.calls.Load(); n != 5 {
+		t.Errorf("再次连续失败 2 次后应冷却，共查询 %d 次", n)
+	}
+}
+
+func TestGeoChainCooldownDisabled(t *testing.T) {
+	clock := newFakeClock()
+	dead := &stubProvider{name: "dead", err: errors.New("timeout")}
+	c := newTestChain(t, clock, 0, 1, dead)
+	for range 3 {
+		c.Lookup(context.Background(), "203.0.113.9")
+	}
+	if n := dead.calls.Load(); n != 3 {
+		t.Errorf("cooldown 为 0 时不应跳过，共查询 %d 次", n)
+	}
+	if err := c.cooling(); err != nil {
+		t.Errorf("不应处于冷却: %v", err)
+	}
+}
+
+func TestGeoChainAllCooling(t *testing.T) {
+	clock := newFakeClock()
+	dead := &stubProvider{name: "dead", err: errors.New("timeout")}
+	c := newTestChain(t, clock, time.Minute, 1, dead)
+	if _, err := c.Lookup(context.Background(), "203.0.113.9"); err == nil {
+		t.Fatal("应返回错误")
+	}
+	if err := c.cooling(); err == nil {
+		t.Error("所有数据源都在冷却中")
+	}
+	// 全部冷却时直接返回，不查询
+	if info, err := c.Lookup(context.Background(), "203.0.113.9"); info != nil || err != nil || dead.calls.Load() != 1 {
+		t.Errorf("全部冷却时应直接返回: %+v, %v, %d 次", info, err, dead.calls.Load())
+	}
+	clock.advance(time.Minute + time.Second)
+	if err := c.cooling(); err != nil {
+		t.Errorf("冷却应已结束: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoRecord MMDB 中使用到的字段，兼容 MaxMind GeoLite2 与 DB-IP 的 City/ASN 库
+type geoRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// geoDB 本地 MMDB 数据库，文件变化后自动重新加载
+type geoDB struct {
+	path    string
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	modTime time.Time
+}
+
+func openGeoDB(path string) (*geoDB, error) {
+	db := &geoDB{path: path}
+	if _, err := db.reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// reload 在文件修改时间变化时重新打开数据库，返回是否发生了重新加载
+func (db *geoDB) reload() (bool, error) {
+	stat, err := os.Stat(db.path)
+	if err != nil {
+		return false, err
+	}
+
+	db.mu.RLock()
+	unchanged := db.reader != nil && stat.ModTime().Equal(db.modTime)
+	db.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	reader, err := maxminddb.Open(db.path)
+	if err != nil {
+		return false, err
+	}
+
+	db.mu.Lock()
+	old := db.reader
+	db.reader = reader
+	db.modTime = stat.ModTime()
+	db.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	return true, nil
+}
+
+// watch 按固定间隔检查数据库文件是否更新
+func (db *geoDB) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reloaded, err := db.reload()
+		if err != nil {
+			log.Printf("重新加载地理位置数据库失败: %v", err)
+			continue
+		}
+		if reloaded {
+			log.Printf("已重新加载地理位置数据库: %s", db.path)
+		}
+	}
+}
+
+// geoDBs 多个本地数据库，MaxMind 和 DB-IP 的 City 与 ASN 是分开的文件，
+// 查询时按顺序合并各库的记录
+type geoDBs []*geoDB
+
+// lookup 查询各数据库并合并结果，所有数据库都没有该 IP 时返回 nil
+func (dbs geoDBs) lookup(ip string) (*geoRecord, error) {
+	var merged *geoRecord
+	for _, db := range dbs {
+		record, err := db.lookup(ip)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", db.path, err)
+		}
+		switch {
+		case record == nil:
+		case merged == nil:
+			merged = record
+		default:
+			merged.merge(record)
+		}
+	}
+	return merged, nil
+}
+
+// merge 用 o 补充 r 中没有的字段，已有的字段保持不变，即排在前面的数据库优先
+func (r *geoRecord) merge(o *geoRecord) {
+	if r.Country.ISOCode == "" && len(r.Country.Names) == 0 {
+		r.Country = o.Country
+	}
+	if len(r.Subdivisions) == 0 {
+		r.Subdivisions = o.Subdivisions
+	}
+	if len(r.City.Names) == 0 {
+		r.City = o.City
+	}
+	if r.Location.Latitude == 0 && r.Location.Longitude == 0 {
+		r.Location.Latitude, r.Location.Longitude = o.Location.Latitude, o.Location.Longitude
+	}
+	if r.Location.TimeZone == "" {
+		r.Location.TimeZone = o.Location.TimeZone
+	}
+	if r.ASN == 0 {
+		r.ASN = o.ASN
+	}
+	if r.ASOrg == "" {
+		r.ASOrg = o.ASOrg
+	}
+}
+
+// lookup 查询 IP 对应的记录，数据库中没有该 IP 时返回 nil
+func (db *geoDB) lookup(ip string) (*geoRecord, error) {
+	parsedIP := net.ParseIP(ip)
+	if parsedIP == nil {
+		return nil, fmt.Errorf("无效的IP地址: %s", ip)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var record geoRecord
+	_, ok, err := db.reader.LookupNetwork(parsedIP, &record)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return &record, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeTestMMDB 生成只有一个节点的 IPv4 数据库：首位为 0 的地址（0.0.0.0/1）对应 record，
+// 其余地址没有记录
+func writeTestMMDB(t *testing.T, name string, record map[string]any) string {
+	t.Helper()
+	const nodeCount = 1
+
+	var buf bytes.Buffer
+	// 搜索树，记录长度 24 位：左子树指向数据区偏移 0，右子树为空
+	writeUint24 := func(v uint32) { buf.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)}) }
+	writeUint24(nodeCount + 16)
+	writeUint24(nodeCount)
+	buf.Write(make([]byte, 16))
+	encodeMMDB(&buf, record)
+
+	buf.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeMMDB(&buf, map[string]any{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               name,
+		"languages":                   []any{},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(1700000000),
+		"description":                 map[string]any{},
+	})
+
+	path := filepath.Join(t.TempDir(), name+".mmdb")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// encodeMMDB 按 MaxMind DB 格式编码测试用到的类型
+func encodeMMDB(buf *bytes.Buffer, v any) {
+	control := func(typ, size int) {
+		// 29 及以上的长度写在控制字节之后，测试数据不超过 284
+		extra := -1
+		if size >= 29 {
+			size, extra = 29, size-29
+		}
+		if typ > 7 {
+			buf.WriteByte(byte(size))
+			buf.WriteByte(byte(typ - 7))
+		} else {
+			buf.WriteByte(byte(typ<<5 | size))
+		}
+		if extra >= 0 {
+			buf.WriteByte(byte(extra))
+		}
+	}
+	writeUint := func(typ int, n uint64) {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		trimmed := bytes.TrimLeft(b[:], "\x00")
+		control(typ, len(trimmed))
+		buf.Write(trimmed)
+	}
+
+	switch v := v.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case float64:
+		control(3, 8)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		writeUint(5, uint64(v))
+	case uint32:
+		writeUint(6, uint64(v))
+	case uint64:
+		writeUint(9, v)
+	case []any:
+		control(11, len(v))
+		for _, item := range v {
+			encodeMMDB(buf, item)
+		}
+	case map[string]any:
+		control(7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeMMDB(buf, k)
+			encodeMMDB(buf, v[k])
+		}
+	default:
+		panic("不支持的类型")
+	}
+}
+
+func TestGeoDBsMerge(t *testing.T) {
+	city := writeTestMMDB(t, "GeoLite2-City", map[string]any{
+		"country": map[string]any{"iso_code": "JP", "names": map[string]any{"en": "Japan", "zh-CN": "日本"}},
+		"subdivisions": []any{
+			map[string]any{"iso_code": "13", "names": map[string]any{"en": "Tokyo", "zh-CN": "东京都"}},
+		},
+		"city":     map[string]any{"names": map[string]any{"en": "Shinjuku"}},
+		"location": map[string]any{"latitude": 35.6895, "longitude": 139.6917, "time_zone": "Asia/Tokyo"},
+	})
+	asn := writeTestMMDB(t, "GeoLite2-ASN", map[string]any{
+		"autonomous_system_number":       uint32(2516),
+		"autonomous_system_organization": "KDDI CORPORATION",
+	})
+	// 国家与 City 库不同，排在后面时不应覆盖
+	country := writeTestMMDB(t, "GeoLite2-Country", map[string]any{
+		"country": map[string]any{"iso_code": "US"},
+	})
+
+	s := NewServer(assets)
+	if !s.LoadGeoDB([]string{city, " " + asn, "", country}, 0) {
+		t.Fatalf("加载失败: %v", s.geoDBErr)
+	}
+	if s.geoDBErr != nil || len(s.geoDB) != 3 {
+		t.Fatalf("应加载 3 个数据库: %d, %v", len(s.geoDB), s.geoDBErr)
+	}
+
+	p := &mmdbProvider{db: s.geoDB}
+	info, err := p.Lookup(context.Background(), "1.2.3.4")
+	if err != nil || info == nil {
+		t.Fatalf("查询失败: %v, %v", info, err)
+	}
+	if info.Country != "JP" || info.Region != "Tokyo" || info.City != "Shinjuku" || info.TimeZone != "Asia/Tokyo" {
+		t.Errorf("City 库的字段不正确: %+v", info)
+	}
+	if info.ASN != 2516 || info.ASName != "KDDI CORPORATION" {
+		t.Errorf("ASN 库的字段没有合并: %+v", info)
+	}
+	if info.Names["zh"].Region != "东京都" {
+		t.Errorf("地区译名不正确: %+v", info.Names)
+	}
+
+	if info, err := p.Lookup(context.Background(), "200.0.0.1"); err != nil || info != nil {
+		t.Errorf("所有库都没有的地址应返回 nil: %+v, %v", info, err)
+	}
+}
+
+func TestLoadGeoDBPartialFailure(t *testing.T) {
+	asn := writeTestMMDB(t, "GeoLite2-ASN", map[string]any{"autonomous_system_number": uint32(13335)})
+
+	s := NewServer(assets)
+	if !s.LoadGeoDB([]string{"/nonexistent/GeoLite2-City.mmdb", asn}, 0) {
+		t.Fatal("部分文件可用时应返回 true")
+	}
+	if len(s.geoDB) != 1 || s.geoDBErr == nil {
+		t.Errorf("应加载 1 个数据库并记录失败原因: %d, %v", len(s.geoDB), s.geoDBErr)
+	}
+
+	s = NewServer(assets)
+	if s.LoadGeoDB([]string{""}, 0) || s.geoDBErr != nil {
+		t.Errorf("未指定文件时应返回 false 且没有错误: %v", s.geoDBErr)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServerOptions HTTP 服务的超时配置
+type ServerOptions struct {
+	ReadTimeout       time.Duration // 读取整个请求的超时
+	ReadHeaderTimeout time.Duration // 读取请求头的超时，防止慢速连接占用
+	WriteTimeout      time.Duration // 写响应的超时，需要大于地理位置查询超时加渲染时间
+	IdleTimeout       time.Duration // keep-alive 连接的空闲超时
+	ShutdownTimeout   time.Duration // 关闭时等待进行中请求完成的最长时间
+}
+
+func defaultServerOptions() ServerOptions {
+	return ServerOptions{
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ShutdownTimeout:   15 * time.Second,
+	}
+}
+
+// SetServerOptions 设置 HTTP 服务的超时
+func (s *Server) SetServerOptions(opts ServerOptions) error {
+	if opts.WriteTimeout > 0 && opts.WriteTimeout <= s.geoTimeout {
+		return fmt.Errorf("写超时 %s 应大于地理位置查询超时 %s", opts.WriteTimeout, s.geoTimeout)
+	}
+	s.serverOpts = opts
+	return nil
+}
+
+// newHTTPServer 按配置创建 http.Server
+func (s *Server) newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       s.serverOpts.ReadTimeout,
+		ReadHeaderTimeout: s.serverOpts.ReadHeaderTimeout,
+		WriteTimeout:      s.serverOpts.WriteTimeout,
+		IdleTimeout:       s.serverOpts.IdleTimeout,
+	}
+}
+
+// shutdown 停止接受新连接并等待进行中的请求完成，超过期限后强制断开
+func (s *Server) shutdown(servers ...*http.Server) error {
+	s.draining.Store(true)
+	log.Printf("正在关闭服务，最多等待 %s 让进行中的请求完成", s.serverOpts.ShutdownTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.serverOpts.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	for _, srv := range servers {
+		if srv == nil {
+			continue
+		}
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+			errs = append(errs, fmt.Errorf("%s: %w", srv.Addr, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("等待请求完成超时，已强制断开: %w", errors.Join(errs...))
+	}
+	log.Printf("所有请求已完成")
+	return nil
+}
+
+// healthzHandler 存活检查，进程能处理请求即返回 200
+func (s *Server) healthzHandler(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyzHandler 就绪检查，字体、logo、地理位置数据源初始化成功且不在关闭过程中时返回 200。
+// 数据源冷却、使用内嵌 logo 等降级情况不影响就绪状态，卡片仍可正常返回，只在 warnings 中列出
+func (s *Server) readyzHandler(c *gin.Context) {
+	checks, warnings := s.readinessChecks()
+	ready := true
+	for _, result := range checks {
+		if result != "ok" {
+			ready = false
+		}
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+	body := gin.H{"status": status, "checks": checks}
+	if len(warnings) > 0 {
+		body["warnings"] = warnings
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(code, body)
+}
+
+// readinessChecks 返回各组件的状态，正常为 "ok"，否则为错误原因；
+// warnings 为不影响就绪状态的降级原因
+func (s *Server) readinessChecks() (checks, warnings map[string]string) {
+	checks = make(map[string]string)
+	warnings = make(map[string]string)
+	result := func(name string, err error) {
+		checks[name] = "ok"
+		if err != nil {
+			checks[name] = err.Error()
+		}
+	}
+
+	if s.draining.Load() {
+		result("server", errors.New("正在关闭"))
+	} else {
+		result("server", nil)
+	}
+
+	switch {
+	case s.fontErr != nil:
+		result("fonts", s.fontErr)
+	case s.fonts == nil:
+		result("fonts", errors.New("未加载字体"))
+	default:
+		result("fonts", nil)
+		// 缺字只影响 PNG 上的部分文字，SVG 由浏览器使用系统字体
+		if err := s.checkFontCoverage(); err != nil {
+			warnings["fonts"] = err.Error()
+		}
+	}
+
+	// 外部 logo 加载失败时已回退到内嵌 logo，卡片可以正常绘制
+	if s.logoImage == nil {
+		result("logo", errors.New("未加载 logo"))
+	} else {
+		result("logo", nil)
+		if s.logoErr != nil {
+			warnings["logo"] = s.logoErr.Error() + "，使用内嵌logo"
+		}
+	}
+
+	if s.geoDBErr != nil {
+		result("geodb", s.geoDBErr)
+	}
+	if len(s.geo.providers) == 0 {
+		result("geo", errors.New("没有可用的地理位置数据源"))
+	} else {
+		result("geo", nil)
+	}
+	// 数据源冷却是上游暂时不可用，所有实例会同时进入，不能因此摘除服务
+	if err := s.geo.cooling(); err != nil {
+		warnings["geo"] = err.Error()
+	}
+	return checks, warnings
+}
+
+// cooling 所有数据源都在冷却期内时返回错误，此时卡片显示地区未知
+func (c *geoChain) cooling() error {
+	var names []string
+	for _, p := range c.providers {
+		if p.available(c.now()) {
+			return nil
+		}
+		names = append(names, p.Name())
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("所有地理位置数据源都在冷却中: %s", strings.Join(names, ", "))
+}
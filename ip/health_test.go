@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type failingProvider struct{}
+
+func (failingProvider) Name() string { return "failing" }
+
+func (failingProvider) Lookup(context.Context, string) (*GeoInfo, error) {
+	return nil, errors.New("rate limited")
+}
+
+func readyz(t *testing.T, s *Server) (int, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/readyz", nil)
+	s.readyzHandler(c)
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, body
+}
+
+func TestReadyz(t *testing.T) {
+	s := NewServer(assets)
+	s.LoadLogo("")
+	// 测试环境只有内置字体，使用英文避免缺字警告
+	s.SetDefaultLang("en")
+	if code, body := readyz(t, s); code != http.StatusOK || body["warnings"] != nil {
+		t.Fatalf("初始状态: %d %v", code, body)
+	}
+
+	// 数据源冷却和外部 logo 回退只是降级，不影响就绪状态
+	s.geo = newGeoChain([]GeoProvider{failingProvider{}}, time.Minute, 1)
+	s.geo.Lookup(context.Background(), "203.0.113.9")
+	s.LoadLogo("/nonexistent/logo.png")
+	code, body := readyz(t, s)
+	if code != http.StatusOK {
+		t.Fatalf("降级时应就绪: %d %v", code, body)
+	}
+	warnings, _ := body["warnings"].(map[string]any)
+	if warnings["geo"] == nil || warnings["logo"] == nil {
+		t.Errorf("warnings 应包含 geo 和 logo: %v", body)
+	}
+
+	// 初始化失败和关闭过程中返回 503
+	for name, breakServer := range map[string]func(*Server){
+		"fonts":  func(s *Server) { s.fontErr = errors.New("broken") },
+		"logo":   func(s *Server) { s.logoImage = nil },
+		"geodb":  func(s *Server) { s.geoDBErr = errors.New("broken") },
+		"server": func(s *Server) { s.draining.Store(true) },
+	} {
+		s := NewServer(assets)
+		s.LoadLogo("")
+		breakServer(s)
+		if code, body := readyz(t, s); code != http.StatusServiceUnavailable {
+			t.Errorf("%s 失败时应返回 503: %d %v", name, code, body)
+		}
+	}
+}
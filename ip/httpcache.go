@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 缓存策略
+const (
+	cachePrivate = "private"  // 只允许浏览器缓存，卡片内容因访客而异，默认使用
+	cachePublic  = "public"   // 允许 CDN 等共享缓存按 Vary 分别缓存
+	cacheNoStore = "no-store" // 不缓存，用作访问统计像素时每次都回源
+)
+
+// CachePolicy 卡片响应的缓存策略
+type CachePolicy struct {
+	Mode   string        // private、public 或 no-store
+	MaxAge time.Duration // 缓存有效期，no-store 时忽略
+}
+
+// SetCachePolicy 设置卡片响应的 Cache-Control
+func (s *Server) SetCachePolicy(p CachePolicy) error {
+	switch p.Mode {
+	case cachePrivate, cachePublic, cacheNoStore:
+	default:
+		return fmt.Errorf("未知的缓存策略: %s，可选 private,public,no-store", p.Mode)
+	}
+	if p.MaxAge < 0 {
+		return fmt.Errorf("缓存时间不能为负数: %s", p.MaxAge)
+	}
+	s.cachePolicy = p
+	return nil
+}
+
+// cacheControl 返回 Cache-Control 头的值
+func (p CachePolicy) cacheControl() string {
+	if p.Mode == cacheNoStore {
+		return "no-store"
+	}
+	return fmt.Sprintf("%s, max-age=%d", p.Mode, int(p.MaxAge.Seconds()))
+}
+
+// varyHeaders 返回影响响应内容的请求头。访客 IP 来自代理头；格式由 Accept 协商时
+// 随 Accept 和 User-Agent（命令行工具返回 ANSI）变化；卡片和 JSON 还包含 UA、
+// Client Hints 解析结果和按 Accept-Language 选择的语言
+func (s *Server) varyHeaders(r *http.Request, format string) []string {
+	vary := s.proxyHeaders()
+	_, explicit := formatFromURL(r)
+	if !explicit {
+		vary = append(vary, "Accept", "User-Agent")
+	}
+	if format == formatText {
+		return vary
+	}
+	if explicit {
+		vary = append(vary, "User-Agent")
+	}
+	if r.URL.Query().Get("lang") == "" {
+		vary = append(vary, "Accept-Language")
+	}
+	return append(vary, acceptClientHints...)
+}
+
+// renderETag 根据实际输出的内容计算 ETag：纯文本只有 IP，JSON 包含全部查询结果，
+// 卡片包含语言、尺寸、各字段的值和图标，图片再加上主题、缩放、编码参数和
+// 静态图层的版本。内容相同的请求得到相同的 ETag，可以直接返回 304。
+// 当前时间每秒都变，计入后 ETag 几乎不会匹配，因此不计入；时区仍然计入，
+// 重新验证命中时客户端继续显示缓存中的时间
+func (s *Server) renderETag(format, lang string, card cardData, resp *ipResponse, theme, dark *Theme, scale, quality int) string {
+	h := fnv.New64a()
+	add := func(v ...any) {
+		for _, x := range v {
+			fmt.Fprintf(h, "%v\x00", x)
+		}
+	}
+
+	add(format, card.IP)
+	switch format {
+	case formatText:
+	case formatJSON:
+		// GeoInfo 是指针，单独按值计算
+		r := *resp
+		r.GeoInfo = nil
+		r.Time, r.Timestamp = "", 0
+		add(r)
+		if resp.GeoInfo != nil {
+			add(*resp.GeoInfo)
+		}
+	default:
+		add(lang, card.Fields, card.Width, card.Height)
+		fields := card.Fields
+		if len(fields) == 0 {
+			fields = cardPresets["default"].Fields
+		}
+		for _, name := range fields {
+			f := cardFields[name]
+			if name == "time" {
+				add(name, resp.Zone, resp.UTCOffset)
+				continue
+			}
+			add(name, f.value(card))
+			if f.icon != nil {
+				add(f.icon(card))
+			}
+		}
+		if format == formatANSI {
+			break
+		}
+		add(*theme)
+		if dark != nil {
+			add(*dark)
+		}
+		if rasterFormats[format] {
+			add(scale, s.imageOpts, s.staticContent().version)
+			if format == formatJPEG {
+				add(quality)
+			}
+		}
+	}
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
+
+// notModified 设置缓存相关的响应头，If-None-Match 与 ETag 匹配时返回 304 和 true。
+// 内容随访客 IP、UA 等请求头变化，共享缓存需要按 Vary 区分
+func (s *Server) notModified(c *gin.Context, format string, etag func() string) bool {
+	c.Header("Cache-Control", s.cachePolicy.cacheControl())
+	c.Writer.Header().Add("Vary", strings.Join(s.varyHeaders(c.Request, format), ", "))
+	if s.cachePolicy.Mode == cacheNoStore {
+		return false
+	}
+	tag := etag()
+	c.Header("ETag", tag)
+	if etagMatch(c.GetHeader("If-None-Match"), tag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// etagMatch 按弱比较判断 If-None-Match 是否包含 etag
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
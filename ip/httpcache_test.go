@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETagRevalidation(t *testing.T) {
+	s, _ := testServer(t)
+	s.geo = newGeoChain([]GeoProvider{&stubProvider{name: "stub", info: &GeoInfo{Country: "AU", TimeZone: "Australia/Brisbane"}}}, time.Minute, 1)
+	hints := strings.Join(acceptClientHints, ", ")
+
+	tests := []struct {
+		target string
+		vary   string
+	}{
+		{"/api/ip.json", "X-Forwarded-For, User-Agent, Accept-Language, " + hints},
+		{"/api/ip.svg", "X-Forwarded-For, User-Agent, Accept-Language, " + hints},
+		{"/api/ip.png?lang=en", "X-Forwarded-For, User-Agent, " + hints},
+		{"/api/ip.txt", "X-Forwarded-For"},
+	}
+	etags := make([]string, len(tests))
+	for i, tt := range tests {
+		w := serveCard(s, tt.target, "203.0.113.9:5000", nil)
+		if w.Code != http.StatusOK || w.Header().Get("ETag") == "" {
+			t.Fatalf("%s: %d，ETag %q", tt.target, w.Code, w.Header().Get("ETag"))
+		}
+		etags[i] = w.Header().Get("ETag")
+	}
+
+	// 跨过整秒，当前时间变化后 ETag 仍应匹配
+	time.Sleep(time.Second)
+
+	for i, tt := range tests {
+		w := serveCard(s, tt.target, "203.0.113.9:5000", http.Header{"If-None-Match": {etags[i]}})
+		if w.Code != http.StatusNotModified {
+			t.Errorf("%s: 带回 ETag 应返回 304，实际 %d", tt.target, w.Code)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("%s: 304 不应有响应体: %q", tt.target, w.Body.String())
+		}
+		if got := w.Header().Get("ETag"); got != etags[i] {
+			t.Errorf("%s: ETag 变化 %s -> %s", tt.target, etags[i], got)
+		}
+		if got := w.Header().Get("Vary"); got != tt.vary {
+			t.Errorf("%s: Vary = %q，期望 %q", tt.target, got, tt.vary)
+		}
+	}
+
+	// 时区不同时内容不同
+	w := serveCard(s, "/api/ip.json?tz=Asia/Tokyo", "203.0.113.9:5000", http.Header{"If-None-Match": {etags[0]}})
+	if w.Code != http.StatusOK {
+		t.Errorf("时区变化后不应返回 304: %d", w.Code)
+	}
+}
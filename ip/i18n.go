@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// messages 卡片上的文字
+type messages struct {
+	YourIP         string
+	Time           string
+	Region         string
+	ISP            string
+	Org            string
+	Coords         string
+	TimeZone       string
+	Client         string
+	Desktop        string
+	Mobile         string
+	Tablet         string
+	Bot            string
+	Online         string
+	UnknownBrowser string
+	LocalNetwork   string
+	UnknownRegion  string
+	RegionBusy     string // 在线查询预算用完时显示
+}
+
+// fallbackLang 字体无法绘制所选语言时位图卡片使用的语言，内置 Go 字体即可绘制
+const fallbackLang = "en"
+
+var catalogs = map[string]*messages{
+	"zh": {
+		YourIP:         "您的IP",
+		Time:           "时间",
+		Region:         "地区",
+		ISP:            "运营商",
+		Org:            "组织",
+		Coords:         "坐标",
+		TimeZone:       "时区",
+		Client:         "客户端",
+		Desktop:        "桌面",
+		Mobile:         "手机",
+		Tablet:         "平板",
+		Bot:            "爬虫",
+		Online:         "在线",
+		UnknownBrowser: "未知浏览器",
+		LocalNetwork:   "本地网络",
+		UnknownRegion:  "未知地区",
+		RegionBusy:     "地区暂不可用",
+	},
+	"en": {
+		YourIP:         "Your IP",
+		Time:           "Time",
+		Region:         "Region",
+		ISP:            "ISP",
+		Org:            "Organization",
+		Coords:         "Coordinates",
+		TimeZone:       "Time zone",
+		Client:         "Client",
+		Desktop:        "Desktop",
+		Mobile:         "Mobile",
+		Tablet:         "Tablet",
+		Bot:            "Bot",
+		Online:         "Online",
+		UnknownBrowser: "Unknown browser",
+		LocalNetwork:   "Local network",
+		UnknownRegion:  "Unknown region",
+		RegionBusy:     "Region unavailable",
+	},
+	"ja": {
+		YourIP:         "あなたのIP",
+		Time:           "時刻",
+		Region:         "地域",
+		ISP:            "プロバイダ",
+		Org:            "組織",
+		Coords:         "座標",
+		TimeZone:       "タイムゾーン",
+		Client:         "クライアント",
+		Desktop:        "デスクトップ",
+		Mobile:         "モバイル",
+		Tablet:         "タブレット",
+		Bot:            "ボット",
+		Online:         "オンライン",
+		UnknownBrowser: "不明なブラウザ",
+		LocalNetwork:   "ローカルネットワーク",
+		UnknownRegion:  "不明な地域",
+		RegionBusy:     "地域情報は一時的に利用できません",
+	},
+	"ru": {
+		YourIP:         "Ваш IP",
+		Time:           "Время",
+		Region:         "Регион",
+		ISP:            "Провайдер",
+		Org:            "Организация",
+		Coords:         "Координаты",
+		TimeZone:       "Часовой пояс",
+		Client:         "Клиент",
+		Desktop:        "Компьютер",
+		Mobile:         "Телефон",
+		Tablet:         "Планшет",
+		Bot:            "Бот",
+		Online:         "В сети",
+		UnknownBrowser: "Неизвестный браузер",
+		LocalNetwork:   "Локальная сеть",
+		UnknownRegion:  "Неизвестный регион",
+		RegionBusy:     "Регион временно недоступен",
+	},
+}
+
+// deviceName 返回设备类型的本地化名称
+func (m *messages) deviceName(device string) string {
+	switch device {
+	case deviceDesktop:
+		return m.Desktop
+	case deviceMobile:
+		return m.Mobile
+	case deviceTablet:
+		return m.Tablet
+	case deviceBot:
+		return m.Bot
+	}
+	return ""
+}
+
+// texts 返回卡片上的全部文字
+func (m *messages) texts() []string {
+	v := reflect.ValueOf(*m)
+	texts := make([]string, 0, v.NumField())
+	for i := range v.NumField() {
+		texts = append(texts, v.Field(i).String())
+	}
+	return texts
+}
+
+// langTags 用于本地化国家名称的语言标签
+var langTags = map[string]language.Tag{
+	"zh": language.SimplifiedChinese,
+	"en": language.English,
+	"ja": language.Japanese,
+	"ru": language.Russian,
+}
+
+// mmdbLangs MMDB names 字段中的语言代码与卡片语言的对应关系
+var mmdbLangs = map[string]string{
+	"zh-CN": "zh",
+	"en":    "en",
+	"ja":    "ja",
+	"ru":    "ru",
+}
+
+// SetDefaultLang 设置无法从请求判断语言时使用的语言
+func (s *Server) SetDefaultLang(lang string) error {
+	if _, ok := catalogs[lang]; !ok {
+		return fmt.Errorf("不支持的语言: %s", lang)
+	}
+	s.defaultLang = lang
+	return nil
+}
+
+// resolveLang 按 ?lang= 参数、Accept-Language 头的顺序选择语言
+func (s *Server) resolveLang(r *http.Request) string {
+	if lang := matchLang(r.URL.Query().Get("lang")); lang != "" {
+		return lang
+	}
+
+	ranges := parseAccept(r.Header.Get("Accept-Language"))
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	for _, r := range ranges {
+		if r.q <= 0 {
+			continue
+		}
+		if lang := matchLang(r.mimeType); lang != "" {
+			return lang
+		}
+	}
+	return s.defaultLang
+}
+
+// matchLang 按主语言子标签匹配，如 zh-CN、zh_TW 都对应 zh
+func matchLang(tag string) string {
+	primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	primary, _, _ = strings.Cut(primary, "_")
+	if _, ok := catalogs[primary]; ok {
+		return primary
+	}
+	return ""
+}
+
+// LocalizedLocation 返回指定语言的地区描述。优先使用数据源提供的译名，
+// 国家没有译名时根据国家代码本地化
+func (g *GeoInfo) LocalizedLocation(lang string) string {
+	names := g.Names[lang]
+	country, region, city := names.Country, names.Region, names.City
+
+	if country == "" {
+		country = countryName(g.Country, lang)
+	}
+	if region == "" {
+		region = g.Region
+	}
+	if city == "" {
+		city = g.City
+	}
+	return joinLocation(country, region, city)
+}
+
+// countryName 将两位国家代码转换为本地化名称，无法识别时原样返回
+func countryName(code, lang string) string {
+	tag, ok := langTags[lang]
+	if !ok || len(code) != 2 {
+		return code
+	}
+	region, err := language.ParseRegion(code)
+	if err != nil {
+		return code
+	}
+	if name := display.Regions(tag).Name(region); name != "" {
+		return name
+	}
+	return code
+}
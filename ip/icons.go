@@ -0,0 +1,48 @@
+package main
+
+// iconGrid 图标的设计尺寸，绘制时按字号缩放
+const iconGrid = 16
+
+type iconShapeKind int
+
+const (
+	iconRect iconShapeKind = iota // 描边圆角矩形
+	iconLine                      // 线段，X,Y → X2,Y2
+	iconDot                       // 实心圆
+)
+
+// iconShape 图标的组成部分，坐标基于 16×16 网格
+type iconShape struct {
+	Kind   iconShapeKind
+	X, Y   float64
+	X2, Y2 float64 // 线段终点
+	W, H   float64 // 矩形尺寸
+	R      float64 // 矩形圆角或圆的半径
+}
+
+// iconStrokeWidth 图标描边宽度（网格单位）
+const iconStrokeWidth = 1.5
+
+// deviceIcons 设备类型对应的图标，SVG 与位图渲染器共用
+var deviceIcons = map[string][]iconShape{
+	deviceDesktop: {
+		{Kind: iconRect, X: 1, Y: 2, W: 14, H: 9, R: 1},
+		{Kind: iconLine, X: 8, Y: 11, X2: 8, Y2: 14},
+		{Kind: iconLine, X: 5, Y: 14, X2: 11, Y2: 14},
+	},
+	deviceMobile: {
+		{Kind: iconRect, X: 4, Y: 1, W: 8, H: 14, R: 1.5},
+		{Kind: iconDot, X: 8, Y: 12.2, R: 0.9},
+	},
+	deviceTablet: {
+		{Kind: iconRect, X: 2, Y: 1.5, W: 12, H: 13, R: 1.5},
+		{Kind: iconDot, X: 8, Y: 12, R: 0.9},
+	},
+	deviceBot: {
+		{Kind: iconRect, X: 2, Y: 5, W: 12, H: 9, R: 2},
+		{Kind: iconLine, X: 8, Y: 2.5, X2: 8, Y2: 5},
+		{Kind: iconDot, X: 8, Y: 2, R: 1},
+		{Kind: iconDot, X: 5.5, Y: 9.5, R: 1.2},
+		{Kind: iconDot, X: 10.5, Y: 9.5, R: 1.2},
+	},
+}
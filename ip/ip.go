@@ -2,11 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"embed"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"html"
 	"image"
 	"image/color"
 	"image/jpeg"
@@ -18,89 +17,160 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/fogleman/gg"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/image/font"
-	"golang.org/x/image/font/gofont/goregular"
-	"golang.org/x/image/font/opentype"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 )
 
-type ipInfo struct {
-	IP      string `json:"ip"`
-	City    string `json:"city"`
-	Region  string `json:"region"`
-	Country string `json:"country"`
-	Org     string `json:"org"`
-	Loc     string `json:"loc"`
-}
-
 type Server struct {
-	httpClient  *http.Client
-	ipCache     sync.Map
-	logoImage   image.Image
-	titleFont   font.Face
-	bodyFont    font.Face
-	smallFont   font.Face
-	contextPool sync.Pool
-	assets      embed.FS
+	httpClient   *http.Client
+	cache        *geoCache
+	cacheFile    string
+	logoImage    image.Image
+	logoSource   image.Image // 缩放前的原图，用于生成高分辨率 logo
+	logoSizes    sync.Map    // int → image.Image，各像素尺寸的 logo
+	fonts        *fontChain
+	canvasPools  sync.Map // image.Point → *sync.Pool，每种尺寸一个画布池
+	poolCount    atomic.Int32
+	assets       embed.FS
+	geoDB        geoDBs
+	geo          *geoChain
+	geoGroup     singleflight.Group
+	geoTimeout   time.Duration
+	proxies      *trustedProxies
+	cloudflare   *trustedProxies // 开启 -trust-cloudflare 时为 Cloudflare 的 IP 段
+	proxyHeader  string          // 从哪个代理头读取客户端地址
+	themes       map[string]*Theme
+	defaultTheme string
+	defaultLang  string
+	defaultTZ    *time.Location
+	imageOpts    ImageOptions
+	pngEncoder   *png.Encoder
+	cachePolicy  CachePolicy
+	limiter      *clientLimiter
+	geoBudget    *rate.Limiter
+	metrics      *metrics
+	metricsOpts  MetricsOptions
+	certs        *certReloader               // 配置了证书时使用 HTTPS
+	redirectAddr string                      // HTTP 跳转到 HTTPS 的监听地址
+	static       atomic.Pointer[staticCache] // 预先生成的背景图层和 logo 编码
+	serverOpts   ServerOptions
+	draining     atomic.Bool // 正在关闭，就绪检查返回 503
+	fontErr      error       // 以下为初始化失败的原因，就绪检查时报告
+	logoErr      error
+	geoDBErr     error
+	corsOrigins  []string // 允许跨域访问的来源，为空时允许所有来源
+	accessLog    bool
 }
 
 func NewServer(assets embed.FS) *Server {
 	s := &Server{
-		httpClient: &http.Client{Timeout: 5 * time.Second},
-		assets:     assets,
-		contextPool: sync.Pool{
-			New: func() interface{} {
-				return gg.NewContext(600, 200)
-			},
-		},
-	}
+		httpClient:   &http.Client{},
+		geoTimeout:   5 * time.Second,
+		cache:        newGeoCache(10000, 24*time.Hour, 5*time.Minute),
+		assets:       assets,
+		themes:       defaultThemes(),
+		defaultTheme: "dark",
+		defaultLang:  "zh",
+		defaultTZ:    time.Local,
+		imageOpts:    defaultImageOptions(),
+		cachePolicy:  CachePolicy{Mode: cachePrivate, MaxAge: time.Minute},
+		metrics:      newMetrics(),
+		serverOpts:   defaultServerOptions(),
+		accessLog:    true,
+	}
+	s.pngEncoder = newPNGEncoder(s.imageOpts)
+	s.geo = newGeoChain([]GeoProvider{&ipinfoProvider{client: s.httpClient}}, 0, 0)
+	s.geo.metrics = s.metrics
+	s.proxies, _ = parseTrustedProxies([]string{"127.0.0.0/8", "::1"})
+	s.proxyHeader = proxyHeaderXFF
 	s.initFonts()
 	return s
 }
 
-func (s *Server) initFonts() {
-	tt, err := opentype.Parse(goregular.TTF)
-	if err != nil {
-		log.Printf("解析字体失败: %v", err)
+// SetupCache 按配置重建地理位置缓存，并从快照文件恢复上次的缓存
+func (s *Server) SetupCache(opts CacheOptions) {
+	s.cache = newGeoCache(opts.Size, opts.TTL, opts.NegativeTTL)
+	s.cacheFile = opts.File
+	if s.cacheFile == "" {
 		return
 	}
-	
-	s.titleFont, err = opentype.NewFace(tt, &opentype.FaceOptions{
-		Size:    20,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
+
+	n, err := s.cache.Load(s.cacheFile)
 	if err != nil {
-		log.Printf("创建标题字体失败: %v", err)
+		if !os.IsNotExist(err) {
+			log.Printf("读取缓存快照失败: %v", err)
+		}
+		return
 	}
-	
-	s.bodyFont, err = opentype.NewFace(tt, &opentype.FaceOptions{
-		Size:    16,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
-	if err != nil {
-		log.Printf("创建正文字体失败: %v", err)
+	log.Printf("已从缓存快照恢复 %d 条记录", n)
+}
+
+// Close 保存缓存快照
+func (s *Server) Close() {
+	stats := s.cache.Stats()
+	log.Printf("地理位置缓存: %d 条，命中 %d 次，未命中 %d 次", stats.Size, stats.Hits, stats.Misses)
+
+	if s.cacheFile == "" {
+		return
 	}
-	
-	s.smallFont, err = opentype.NewFace(tt, &opentype.FaceOptions{
-		Size:    13,
-		DPI:     72,
-		Hinting: font.HintingFull,
-	})
-	if err != nil {
-		log.Printf("创建小字体失败: %v", err)
+	if err := s.cache.Save(s.cacheFile); err != nil {
+		log.Printf("保存缓存快照失败: %v", err)
+		return
+	}
+	log.Printf("已保存缓存快照: %s", s.cacheFile)
+}
+
+// SetAccessLog 设置是否输出访问日志
+func (s *Server) SetAccessLog(enabled bool) {
+	s.accessLog = enabled
+}
+
+// LoadGeoDB 加载本地 MMDB 地理位置数据库，可以同时指定 City、ASN 等多个文件，
+// 查询时合并各库的记录。reload 大于 0 时定期检查文件更新
+func (s *Server) LoadGeoDB(paths []string, reload time.Duration) bool {
+	var dbs geoDBs
+	var errs []error
+	for _, path := range paths {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		db, err := openGeoDB(path)
+		if err != nil {
+			log.Printf("加载地理位置数据库失败: %v", err)
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("已加载地理位置数据库: %s", path)
+		dbs = append(dbs, db)
+
+		if reload > 0 {
+			go db.watch(reload)
+		}
+	}
+
+	s.geoDB = dbs
+	s.geoDBErr = errors.Join(errs...)
+	if len(dbs) == 0 {
+		if len(errs) > 0 {
+			log.Printf("没有可用的地理位置数据库，使用在线查询")
+		}
+		return false
 	}
+	return true
 }
 
 func (s *Server) LoadLogo(logoPath string) {
+	defer s.resetStatic()
+	s.logoErr = nil
 	if logoPath != "" {
 		file, err := os.Open(logoPath)
 		if err != nil {
 			log.Printf("无法打开外部logo文件: %v，使用内嵌logo", err)
+			s.logoErr = err
 			s.logoImage = s.loadEmbeddedLogo()
 			return
 		}
@@ -116,16 +186,19 @@ func (s *Server) LoadLogo(logoPath string) {
 			img, err = jpeg.Decode(file)
 		default:
 			log.Printf("不支持的图片格式: %s，使用内嵌logo", ext)
+			s.logoErr = fmt.Errorf("不支持的图片格式: %s", ext)
 			s.logoImage = s.loadEmbeddedLogo()
 			return
 		}
 		
 		if err != nil {
 			log.Printf("解码外部logo图片失败: %v，使用内嵌logo", err)
+			s.logoErr = fmt.Errorf("解码外部logo图片失败: %w", err)
 			s.logoImage = s.loadEmbeddedLogo()
 			return
 		}
 		
+		s.logoSource = img
 		s.logoImage = resizeLogo(img, 64, 64)
 		log.Printf("已加载外部logo: %s", logoPath)
 	} else {
@@ -154,6 +227,7 @@ func (s *Server) loadEmbeddedLogo() image.Image {
 		
 		if err == nil {
 			log.Printf("使用默认logo")
+			s.logoSource = img
 			return resizeLogo(img, 64, 64)
 		}
 	}
@@ -239,91 +313,67 @@ func createDefaultLogo() image.Image {
 	return result
 }
 
-func (s *Server) getClientIP(c *gin.Context) string {
-	// 检查各种代理头
-	headers := []string{
-		"CF-Connecting-IP",
-		"X-Forwarded-For",
-		"X-Real-IP",
-		"X-Client-IP",
-		"X-Forwarded",
-		"X-Cluster-Client-IP",
+// lookupGeo 返回地理位置信息及用于显示的地区描述，本地地址和查询失败时信息为 nil
+func (s *Server) lookupGeo(ctx context.Context, ip, lang string) (*GeoInfo, string) {
+	msg := catalogs[lang]
+	if isLocalIP(ip) {
+		return nil, msg.LocalNetwork
 	}
-	
-	for _, header := range headers {
-		if ip := c.GetHeader(header); ip != "" {
-			ips := strings.Split(ip, ",")
-			clientIP := strings.TrimSpace(ips[0])
-			if net.ParseIP(clientIP) != nil {
-				return clientIP
-			}
+
+	info, ok := s.cache.Get(ip)
+	if !ok {
+		ctx, cancel := context.WithTimeout(ctx, s.geoTimeout)
+		defer cancel()
+		var err error
+		if info, err = s.resolveGeo(ctx, ip); errors.Is(err, errGeoBudget) {
+			return nil, msg.RegionBusy
 		}
 	}
-	
-	// 获取远程地址
-	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
-	if err != nil {
-		return c.Request.RemoteAddr
+
+	if info == nil {
+		return nil, msg.UnknownRegion
 	}
-	return ip
+	return info, info.LocalizedLocation(lang)
 }
 
-func (s *Server) lookupGeo(ip string) string {
-	if val, ok := s.ipCache.Load(ip); ok {
-		return val.(string)
-	}
-	
-	if isLocalIP(ip) {
-		loc := "本地网络"
-		s.ipCache.Store(ip, loc)
-		return loc
-	}
-	
-	url := fmt.Sprintf("https://ipinfo.io/%s/json", ip)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "未知地区"
-	}
-	
-	req.Header.Set("User-Agent", "iptracker/2.0")
-	req.Header.Set("Accept", "application/json")
-	
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		log.Printf("地理位置查询失败: %v", err)
-		return "未知地区"
-	}
-	defer resp.Body.Close()
+// resolveGeo 合并同一 IP 的并发查询，所有等待者共享一次上游请求的结果。
+// 上游请求不随某个客户端断开而取消，查询完成后结果写入缓存；
+// 每个等待者最多等到自己的 ctx 结束
+func (s *Server) resolveGeo(ctx context.Context, ip string) (*GeoInfo, error) {
+	ch := s.geoGroup.DoChan(ip, func() (interface{}, error) {
+		lookupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.geoTimeout)
+		defer cancel()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("地理位置查询返回状态码: %d", resp.StatusCode)
-		return "未知地区"
-	}
+		// 查询失败时 info 为 nil，按负缓存保存，避免故障的数据源被反复请求；
+		// 预算用完不是数据源的问题，不缓存，预算恢复后可以重新查询
+		info, err := s.geo.Lookup(lookupCtx, ip)
+		if errors.Is(err, errGeoBudget) {
+			return (*GeoInfo)(nil), err
+		}
+		s.cache.Set(ip, info)
+		return info, nil
+	})
 
-	var info ipInfo
-	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-		log.Printf("解析地理位置信息失败: %v", err)
-		return "未知地区"
+	select {
+	case res := <-ch:
+		return res.Val.(*GeoInfo), res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
-	
+}
+
+func joinLocation(country, region, city string) string {
 	var parts []string
-	if info.Country != "" {
-		parts = append(parts, info.Country)
+	if country != "" {
+		parts = append(parts, country)
 	}
-	if info.Region != "" {
-		parts = append(parts, info.Region)
+	if region != "" {
+		parts = append(parts, region)
 	}
-	if info.City != "" {
-		parts = append(parts, info.City)
-	}
-	
-	loc := strings.Join(parts, " ")
-	if loc == "" {
-		loc = "未知地区"
+	if city != "" {
+		parts = append(parts, city)
 	}
-	
-	s.ipCache.Store(ip, loc)
-	return loc
+	return strings.Join(parts, " ")
 }
 
 func isLocalIP(ip string) bool {
@@ -335,154 +385,116 @@ func isLocalIP(ip string) bool {
 	return parsedIP.IsLoopback() || parsedIP.IsPrivate() || parsedIP.IsLinkLocalUnicast()
 }
 
-func (s *Server) generateSVG(ip, ua, loc, now string) string {
-	var logoBase64 string
-	if s.logoImage != nil {
-		var buf bytes.Buffer
-		if err := png.Encode(&buf, s.logoImage); err == nil {
-			logoBase64 = base64.StdEncoding.EncodeToString(buf.Bytes())
-		}
-	}
-	
-	if len(ua) > 70 {
-		ua = ua[:67] + "..."
-	}
-	
-	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="600" height="200" viewBox="0 0 600 200">
-  <defs>
-    <linearGradient id="bg" x1="0%%" y1="0%%" x2="100%%" y2="100%%">
-      <stop offset="0%%" style="stop-color:#1e293b;stop-opacity:1" />
-      <stop offset="100%%" style="stop-color:#0f172a;stop-opacity:1" />
-    </linearGradient>
-    <filter id="shadow" x="-20%%" y="-20%%" width="140%%" height="140%%">
-      <feDropShadow dx="0" dy="4" stdDeviation="8" flood-color="#000" flood-opacity="0.3"/>
-    </filter>
-  </defs>
-  <rect width="100%%" height="100%%" fill="url(#bg)" rx="16" ry="16" filter="url(#shadow)"/>
-  <image x="24" y="24" width="64" height="64" href="data:image/png;base64,%s"/>
-  <text x="112" y="50" fill="#ffffff" font-family="system-ui, -apple-system, sans-serif" font-size="20" font-weight="600">您的IP: %s</text>
-  <text x="112" y="78" fill="#cbd5e1" font-family="system-ui, -apple-system, sans-serif" font-size="16">时间: %s</text>
-  <text x="112" y="106" fill="#cbd5e1" font-family="system-ui, -apple-system, sans-serif" font-size="16">地区: %s</text>
-  <text x="24" y="150" fill="#94a3b8" font-family="system-ui, -apple-system, monospace" font-size="13">UA: %s</text>
-  <circle cx="570" cy="30" r="8" fill="#10b981" opacity="0.8"/>
-  <text x="550" y="35" fill="#10b981" font-family="system-ui, -apple-system, sans-serif" font-size="12" text-anchor="end">在线</text>
-</svg>`,
-		logoBase64,
-		html.EscapeString(ip),
-		html.EscapeString(now),
-		html.EscapeString(loc),
-		html.EscapeString(ua))
+// ipResponse JSON 接口返回的数据，与图片卡片使用相同的数据
+type ipResponse struct {
+	IP      string `json:"ip"`
+	Version int    `json:"version"`
+	*GeoInfo
+	Location  string     `json:"location"`
+	UA        string     `json:"ua"`
+	Client    ClientInfo `json:"client"`
+	Time      string     `json:"time"`
+	Zone      string     `json:"zone"`
+	UTCOffset string     `json:"utc_offset"`
+	Timestamp int64      `json:"timestamp"`
 }
 
-func (s *Server) generatePNG(ip, ua, loc, now string) []byte {
-	dc := s.contextPool.Get().(*gg.Context)
-	defer s.contextPool.Put(dc)
-	
-	dc.Clear()
-	
-	const width, height = 600, 200
-	const cornerRadius = 16
-	
-	gradient := gg.NewLinearGradient(0, 0, width, height)
-	gradient.AddColorStop(0, color.RGBA{30, 41, 59, 255})
-	gradient.AddColorStop(1, color.RGBA{15, 23, 42, 255})
-	dc.SetFillStyle(gradient)
-	dc.DrawRoundedRectangle(0, 0, width, height, cornerRadius)
-	dc.Fill()
-	
-	dc.SetRGBA(1, 1, 1, 0.1)
-	dc.SetLineWidth(1)
-	dc.DrawRoundedRectangle(0, 0, width, height, cornerRadius)
-	dc.Stroke()
-
-	if s.logoImage != nil {
-		dc.DrawImageAnchored(s.logoImage, 56, 56, 0.5, 0.5)
-	}
-
-	if s.titleFont != nil && s.bodyFont != nil && s.smallFont != nil {
-		dc.SetColor(color.RGBA{255, 255, 255, 255})
-		dc.SetFontFace(s.titleFont)
-		dc.DrawString(fmt.Sprintf("您的IP: %s", ip), 112, 45)
-		
-		dc.SetColor(color.RGBA{203, 213, 225, 255})
-		dc.SetFontFace(s.bodyFont)
-		dc.DrawString(fmt.Sprintf("时间: %s", now), 112, 75)
-		dc.DrawString(fmt.Sprintf("地区: %s", loc), 112, 100)
-		
-		dc.SetColor(color.RGBA{148, 163, 184, 255})
-		dc.SetFontFace(s.smallFont)
-		if len(ua) > 70 {
-			ua = ua[:67] + "..."
-		}
-		dc.DrawString(fmt.Sprintf("UA: %s", ua), 24, 160)
-		
-		dc.SetColor(color.RGBA{16, 185, 129, 255})
-		dc.DrawCircle(570, 30, 8)
-		dc.Fill()
-		
-		dc.SetFontFace(s.smallFont)
-		dc.DrawStringAnchored("在线", 550, 30, 1, 0.5)
+func ipVersion(ip string) int {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return 6
 	}
-
-	var buf bytes.Buffer
-	if err := png.Encode(&buf, dc.Image()); err != nil {
-		log.Printf("PNG 编码失败: %v", err)
-		return nil
-	}
-	return buf.Bytes()
+	return 4
 }
 
 func (s *Server) ipImageHandler(c *gin.Context) {
 	ip := s.getClientIP(c)
+	format := negotiateFormat(c.Request)
+	c.Set("format", format)
+	// 纯文本只有 IP，不查询地理位置，避免消耗上游配额和等待查询超时
+	if format == formatText {
+		if s.notModified(c, format, func() string {
+			return s.renderETag(format, "", cardData{IP: ip}, nil, nil, nil, 0, 0)
+		}) {
+			return
+		}
+		defer s.metrics.observeRender(format, time.Now())
+		c.String(http.StatusOK, ip+"\n")
+		return
+	}
+
+	// 只有卡片和 JSON 读取 Client Hints，其他路由不声明，避免 Critical-CH 让浏览器多一次重试
+	setClientHintHeaders(c.Writer.Header())
+	lang := s.resolveLang(c.Request)
+	// 字体画不出所选语言时位图卡片改用英文，避免缺字方框
+	if rasterFormats[format] {
+		lang = s.rasterLang(lang)
+	}
+	msg := catalogs[lang]
 	ua := c.Request.UserAgent()
 	if ua == "" {
-		ua = "未知浏览器"
+		ua = msg.UnknownBrowser
 	}
 	
-	loc := s.lookupGeo(ip)
-	now := time.Now().Format("2006-01-02 15:04:05")
+	info, loc := s.lookupGeo(c.Request.Context(), ip, lang)
+	client := parseClientInfo(c.Request)
+	// 按访客所在时区显示时间
+	t := time.Now().In(s.resolveTimeZone(c.Query("tz"), info))
+	zone, _ := t.Zone()
+	now := t.Format(cardTimeLayout) + " " + formatZone(t)
 
-	path := c.Request.URL.Path
-	var isSVG bool
-	
-	if strings.HasSuffix(path, ".svg") {
-		isSVG = true
-	} else if strings.HasSuffix(path, ".png") {
-		isSVG = false
-	} else {
-		accept := c.GetHeader("Accept")
-		isSVG = !strings.Contains(accept, "image/png") || strings.Contains(accept, "image/svg+xml")
+	scale := negotiateScale(c.Request)
+	quality := negotiateQuality(c.Request, s.imageOpts.JPEGQuality)
+	theme, dark := s.resolveTheme(c.Query("theme"))
+	card := cardData{IP: ip, UA: ua, Loc: loc, Now: now, Geo: info, Client: client, Msg: msg, cardOptions: parseCardOptions(c.Request.URL.Query())}
+	resp := ipResponse{
+		IP:        ip,
+		Version:   ipVersion(ip),
+		GeoInfo:   info,
+		Location:  loc,
+		UA:        c.Request.UserAgent(),
+		Client:    client,
+		Time:      t.Format(cardTimeLayout),
+		Zone:      zone,
+		UTCOffset: t.Format("-07:00"),
+		Timestamp: t.Unix(),
 	}
 
-	c.Header("Cache-Control", "public, max-age=60")
-	c.Header("ETag", fmt.Sprintf(`"%s-%d"`, ip, time.Now().Unix()/60))
+	if s.notModified(c, format, func() string {
+		return s.renderETag(format, lang, card, &resp, theme, dark, scale, quality)
+	}) {
+		return
+	}
+	defer s.metrics.observeRender(format, time.Now())
 
-	if isSVG {
-		c.Header("Content-Type", "image/svg+xml")
-		c.String(http.StatusOK, s.generateSVG(ip, ua, loc, now))
-	} else {
-		pngData := s.generatePNG(ip, ua, loc, now)
-		if pngData == nil {
+	switch format {
+	case formatJSON:
+		c.JSON(http.StatusOK, resp)
+	case formatANSI:
+		c.String(http.StatusOK, renderANSI(card))
+	case formatPNG, formatJPEG, formatGIF, formatWebP:
+		data := s.generateImage(card, theme, format, scale, quality)
+		if data == nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成图像失败"})
 			return
 		}
-		c.Header("Content-Type", "image/png")
-		c.Data(http.StatusOK, "image/png", pngData)
+		c.Data(http.StatusOK, mimeType(format), data)
+	default:
+		c.Header("Content-Type", "image/svg+xml")
+		c.String(http.StatusOK, s.generateSVG(card, theme, dark))
 	}
 }
 
-func (s *Server) Run(port string) error {
-	gin.SetMode(gin.ReleaseMode)
-	
+// router 注册所有路由
+func (s *Server) router() *gin.Engine {
 	r := gin.New()
 	
-	r.Use(gin.Logger())
+	if s.accessLog {
+		r.Use(gin.Logger())
+	}
 	r.Use(gin.Recovery())
 	
 	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Accept, Content-Type")
+		s.setCORSHeaders(c.Request, c.Writer.Header())
 		
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -492,11 +504,18 @@ func (s *Server) Run(port string) error {
 		c.Next()
 	})
 	
-	api := r.Group("/api")
+	api := r.Group("/api", s.metricsMiddleware, s.rateLimitMiddleware)
 	{
 		api.GET("/ip", s.ipImageHandler)
-		api.GET("/ip.png", s.ipImageHandler)
+		// 位图格式都支持 @2x、@3x 高分辨率路径
+		for _, ext := range []string{"png", "jpg", "jpeg", "gif", "webp"} {
+			api.GET("/ip."+ext, s.ipImageHandler)
+			api.GET("/ip@2x."+ext, s.ipImageHandler)
+			api.GET("/ip@3x."+ext, s.ipImageHandler)
+		}
 		api.GET("/ip.svg", s.ipImageHandler)
+		api.GET("/ip.json", s.ipImageHandler)
+		api.GET("/ip.txt", s.ipImageHandler)
 	}
 	
 	r.GET("/", func(c *gin.Context) {
@@ -505,16 +524,76 @@ func (s *Server) Run(port string) error {
 			"usage": map[string]string{
 				"default": "GET /api/ip (默认 SVG 格式)",
 				"png":     "GET /api/ip.png (PNG 格式)",
+				"png@2x":  "GET /api/ip@2x.png (2 倍分辨率 PNG，也可用 ?scale=1|2|3)",
+				"jpg":     "GET /api/ip.jpg (JPEG 格式，?quality=1-100)",
+				"gif":     "GET /api/ip.gif (GIF 格式)",
+				"webp":    "GET /api/ip.webp (无损 WebP 格式)",
 				"svg":     "GET /api/ip.svg (SVG 格式)",
+				"json":    "GET /api/ip.json (JSON 格式)",
+				"txt":     "GET /api/ip.txt (纯文本，仅IP)",
 			},
 		})
 	})
 
+	// 健康检查不经过限流，探针频繁访问也不会被拒绝
+	r.GET("/healthz", s.healthzHandler)
+	r.GET("/readyz", s.readyzHandler)
+
+	// 监控指标默认不在公开端口上提供，需要明确开启
+	if s.metricsOpts.Public {
+		r.GET("/metrics", gin.WrapF(s.metricsHandler))
+	}
+	return r
+}
+
+// Run 启动服务，ctx 取消后停止接受新请求，等待进行中的请求完成后返回
+func (s *Server) Run(ctx context.Context, port string) error {
+	gin.SetMode(gin.ReleaseMode)
+	r := s.router()
+
+	var metricsSrv *http.Server
+	if s.metricsOpts.Addr != "" {
+		metricsSrv = s.serveMetrics(s.metricsOpts.Addr)
+	}
+
+	// 配置了证书时使用 HTTPS，可以同时监听 HTTP 端口跳转到 HTTPS
+	var redirectSrv *http.Server
+	scheme := "http"
+	if s.certs != nil {
+		scheme = "https"
+		if s.redirectAddr != "" {
+			redirectSrv = s.serveRedirect(s.redirectAddr, port)
+		}
+	}
+
 	serverPort := ":" + port
 	log.Printf(" API 访问链接:")
-	log.Printf("   • http://localhost%s/api/ip (默认 SVG 格式)", serverPort)
-	log.Printf("   • http://localhost%s/api/ip.png (PNG 格式)", serverPort)
-	log.Printf("   • http://localhost%s/api/ip.svg (SVG 格式)", serverPort)
-	
-	return r.Run(serverPort)
+	log.Printf("   • %s://localhost%s/api/ip (默认 SVG 格式)", scheme, serverPort)
+	log.Printf("   • %s://localhost%s/api/ip.png (PNG 格式)", scheme, serverPort)
+	log.Printf("   • %s://localhost%s/api/ip.svg (SVG 格式)", scheme, serverPort)
+	log.Printf("   • %s://localhost%s/api/ip.json (JSON 格式)", scheme, serverPort)
+	log.Printf("   • %s://localhost%s/api/ip.txt (纯文本，仅IP)", scheme, serverPort)
+	
+	srv := s.newHTTPServer(serverPort, r)
+	errc := make(chan error, 1)
+	go func() {
+		if s.certs != nil {
+			srv.TLSConfig = s.tlsConfig()
+			errc <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		for _, other := range []*http.Server{metricsSrv, redirectSrv} {
+			if other != nil {
+				other.Close()
+			}
+		}
+		return err
+	case <-ctx.Done():
+	}
+	return s.shutdown(srv, metricsSrv, redirectSrv)
 }
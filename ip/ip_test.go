@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stubProvider 返回固定结果并记录调用次数的数据源
+type stubProvider struct {
+	name  string
+	info  *GeoInfo
+	err   error
+	calls atomic.Int32
+}
+
+func (p *stubProvider) Name() string { return p.name }
+
+func (p *stubProvider) Lookup(context.Context, string) (*GeoInfo, error) {
+	p.calls.Add(1)
+	return p.info, p.err
+}
+
+// serveCard 以 peer 为直连地址调用 ipImageHandler
+func serveCard(s *Server, target, peer string, header http.Header) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	c.Request.RemoteAddr = peer
+	for k, v := range header {
+		c.Request.Header[k] = v
+	}
+	s.ipImageHandler(c)
+	// 直接调用处理函数时 gin 不会写出只设置了状态码的响应
+	c.Writer.WriteHeaderNow()
+	return w
+}
+
+func TestTextSkipsGeoLookup(t *testing.T) {
+	s, _ := testServer(t)
+	p := &stubProvider{name: "stub", info: &GeoInfo{Country: "AU"}}
+	s.geo = newGeoChain([]GeoProvider{p}, time.Minute, 1)
+
+	for _, tt := range []struct {
+		target string
+		header http.Header
+	}{
+		{"/api/ip.txt", nil},
+		{"/api/ip", http.Header{"User-Agent": {"curl/8.5.0"}, "Accept": {"text/plain"}}},
+	} {
+		w := serveCard(s, tt.target, "203.0.113.9:5000", tt.header)
+		if w.Code != http.StatusOK || w.Body.String() != "203.0.113.9\n" {
+			t.Errorf("%s: %d %q", tt.target, w.Code, w.Body.String())
+		}
+	}
+	if n := p.calls.Load(); n != 0 {
+		t.Errorf("纯文本不应查询地理位置，查询了 %d 次", n)
+	}
+
+	serveCard(s, "/api/ip.json", "203.0.113.9:5000", nil)
+	if n := p.calls.Load(); n != 1 {
+		t.Errorf("JSON 应查询一次地理位置，查询了 %d 次", n)
+	}
+}
+
+func TestClientHintHeaders(t *testing.T) {
+	s, _ := testServer(t)
+	s.geo = newGeoChain([]GeoProvider{&stubProvider{name: "stub"}}, time.Minute, 1)
+	r := s.router()
+
+	for target, want := range map[string]bool{
+		"/api/ip.json": true,
+		"/api/ip.svg":  true,
+		"/api/ip.png":  true,
+		"/api/ip.txt":  false,
+		"/healthz":     false,
+		"/readyz":      false,
+		"/metrics":     false,
+		"/":            false,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		h := w.Header()
+		if got := h.Get("Accept-CH") != "" && h.Get("Critical-CH") != ""; got != want {
+			t.Errorf("%s: Accept-CH %q，Critical-CH %q", target, h.Get("Accept-CH"), h.Get("Critical-CH"))
+		}
+	}
+}
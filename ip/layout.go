@@ -0,0 +1,267 @@
+package main
+
+// cardLayout 卡片的声明式描述，SVG 与位图渲染器按同一份描述绘制，
+// 坐标单位为像素，文字的 Y 坐标为基线位置
+type cardLayout struct {
+	Width    float64
+	Height   float64
+	Scale    float64 // 像素密度，主题中的圆角和边框宽度按此缩放
+	Elements []cardElement
+}
+
+type elementKind int
+
+const (
+	elementBackground elementKind = iota // 圆角矩形背景及边框，铺满整个卡片
+	elementLogo                          // logo 图片
+	elementText
+	elementCircle
+	elementIcon // deviceIcons 中的矢量图标，X、Y 为左上角，W 为边长
+)
+
+// colorRole 元素使用的主题颜色
+type colorRole int
+
+const (
+	roleTitle colorRole = iota
+	roleText
+	roleMuted
+	roleAccent
+)
+
+// textAnchor 文字水平对齐方式，与 SVG text-anchor 对应
+type textAnchor int
+
+const (
+	anchorStart textAnchor = iota
+	anchorEnd
+)
+
+type cardElement struct {
+	Kind     elementKind
+	X, Y     float64
+	W, H     float64 // logo 尺寸
+	R        float64 // 圆的半径
+	Text     string
+	Icon     string
+	Size     float64 // 字号
+	Bold     bool
+	Mono     bool
+	Anchor   textAnchor
+	Color    colorRole
+	Opacity  float64 // 0 表示不透明
+	MaxWidth float64 // 文字最大宽度，超出时横向压缩，0 表示不限制
+}
+
+// cardData 卡片上显示的数据
+type cardData struct {
+	IP     string
+	UA     string
+	Loc    string
+	Now    string
+	Geo    *GeoInfo
+	Client ClientInfo
+	Msg    *messages
+	cardOptions
+}
+
+// 布局的基准尺寸，内容放不下时整体按比例缩小
+const (
+	cardPadding   = 24
+	logoSize      = 64
+	logoGap       = 24
+	titleSize     = 20
+	bodySize      = 16
+	smallSize     = 13
+	statusSize    = 12
+	titleBaseline = 26 // 第一行基线距内边距顶部的距离
+	lineHeight    = 28 // logo 右侧各行的行距
+	sectionGap    = 44 // logo 右侧最后一行到整行内容的距离
+	wideLineGap   = 22 // 整行内容的行距
+	descent       = 10 // 最后一行基线以下预留的高度
+	minLogoWidth  = 300
+)
+
+// buildCardLayout 按字段和尺寸生成卡片布局，调整元素或位置只需修改这里。
+// 第一个字段作为标题，整行字段（UA）排在 logo 下方；
+// 高度不够时字号、行距和 logo 一起按比例缩小
+func buildCardLayout(d cardData) *cardLayout {
+	fields := d.Fields
+	if len(fields) == 0 {
+		fields = cardPresets["default"].Fields
+	}
+	width := d.Width
+	if width == 0 {
+		width = cardPresets["default"].Width
+	}
+
+	type line struct {
+		text string
+		icon string
+	}
+	var column, wide []line
+	for _, name := range fields {
+		f := cardFields[name]
+		value := f.value(d)
+		if value == "" {
+			continue
+		}
+		if name == "ua" {
+			value = truncateWidth(value, 70)
+		}
+		ln := line{text: f.label(d.Msg) + ": " + value}
+		if f.icon != nil {
+			// 有图标时图标代替标签
+			if ln.icon = f.icon(d); ln.icon != "" {
+				ln.text = value
+			}
+		}
+		if f.wide {
+			wide = append(wide, ln)
+		} else {
+			column = append(column, ln)
+		}
+	}
+
+	// 以内边距顶部为原点，按基准尺寸计算各行基线
+	var columnY, wideY []float64
+	y := 0.0
+	for i := range column {
+		if i == 0 {
+			y = titleBaseline
+		} else {
+			y += lineHeight
+		}
+		columnY = append(columnY, y)
+	}
+	for i := range wide {
+		switch {
+		case i > 0:
+			y += wideLineGap
+		case len(column) > 0:
+			y += sectionGap
+		default:
+			y = titleBaseline
+		}
+		wideY = append(wideY, y)
+	}
+	showLogo := width >= minLogoWidth
+	contentHeight := y + descent
+	if showLogo {
+		contentHeight = max(contentHeight, logoSize)
+	}
+
+	height := d.Height
+	pad := float64(cardPadding)
+	scale := 1.0
+	if height == 0 {
+		height = contentHeight + 2*pad
+	} else {
+		pad = min(pad, height*0.15)
+		scale = min(1, (height-2*pad)/contentHeight)
+	}
+
+	l := &cardLayout{Width: width, Height: height, Scale: 1}
+	l.Elements = append(l.Elements, cardElement{Kind: elementBackground})
+
+	textX := pad
+	if showLogo {
+		l.Elements = append(l.Elements, cardElement{Kind: elementLogo, X: pad, Y: pad, W: logoSize * scale, H: logoSize * scale})
+		textX += (logoSize + logoGap) * scale
+	}
+
+	// 右上角的在线状态
+	statusWidth := 0.0
+	if width >= minLogoWidth {
+		cx := width - pad - 6*scale
+		statusWidth = 90 * scale
+		l.Elements = append(l.Elements,
+			cardElement{Kind: elementCircle, X: cx, Y: pad + 6*scale, R: 8 * scale, Color: roleAccent, Opacity: 0.8},
+			cardElement{Kind: elementText, X: cx - 20*scale, Y: pad + 10*scale, Size: statusSize * scale, Anchor: anchorEnd, Color: roleAccent, Text: d.Msg.Online},
+		)
+	}
+
+	for i, ln := range column {
+		e := cardElement{Kind: elementText, X: textX, Y: pad + columnY[i]*scale, Size: bodySize * scale, Color: roleText, Text: ln.text}
+		if i == 0 {
+			e.Size, e.Bold, e.Color = titleSize*scale, true, roleTitle
+		}
+		l.addIcon(&e, ln.icon)
+		e.MaxWidth = width - e.X - pad
+		if i == 0 {
+			e.MaxWidth -= statusWidth
+		}
+		l.Elements = append(l.Elements, e)
+	}
+	for i, ln := range wide {
+		e := cardElement{
+			Kind: elementText, X: pad, Y: pad + wideY[i]*scale, Size: smallSize * scale,
+			Mono: true, Color: roleMuted, Text: ln.text,
+		}
+		l.addIcon(&e, ln.icon)
+		e.MaxWidth = width - e.X - pad
+		l.Elements = append(l.Elements, e)
+	}
+	return l
+}
+
+// scaled 返回所有坐标和尺寸放大 k 倍的布局，用于高分辨率位图，
+// 字体和 logo 按放大后的尺寸绘制而不是拉伸图片
+func (l *cardLayout) scaled(k float64) *cardLayout {
+	if k == 1 {
+		return l
+	}
+	out := &cardLayout{Width: l.Width * k, Height: l.Height * k, Scale: l.Scale * k}
+	out.Elements = make([]cardElement, len(l.Elements))
+	for i, e := range l.Elements {
+		e.X, e.Y, e.W, e.H, e.R = e.X*k, e.Y*k, e.W*k, e.H*k, e.R*k
+		e.Size, e.MaxWidth = e.Size*k, e.MaxWidth*k
+		out.Elements[i] = e
+	}
+	return out
+}
+
+// addIcon 在文字前加图标，图标与字号等高、底部对齐基线，文字随之右移
+func (l *cardLayout) addIcon(e *cardElement, icon string) {
+	if _, ok := deviceIcons[icon]; !ok {
+		return
+	}
+	size := e.Size * 0.9
+	l.Elements = append(l.Elements, cardElement{
+		Kind: elementIcon, Icon: icon, X: e.X, Y: e.Y - size + e.Size*0.05, W: size, Color: e.Color,
+	})
+	e.X += size + e.Size*0.4
+}
+
+// estimateTextWidth 估算文字宽度，SVG 由浏览器排版无法精确测量，
+// 按全角字符 1em、半角字符 0.6em 计算。宁可偏宽：估算超出时文字会被
+// 压缩或拉伸到最大宽度，偏宽时只会轻微拉伸，偏窄则可能超出卡片
+func estimateTextWidth(text string, size float64, bold bool) float64 {
+	em := 0.0
+	for _, r := range text {
+		switch runeWidth(r) {
+		case 2:
+			em += 1
+		case 1:
+			em += 0.6
+		}
+	}
+	if bold {
+		em *= 1.05
+	}
+	return em * size
+}
+
+// roleColor 返回主题中对应角色的颜色
+func (t *Theme) roleColor(role colorRole) string {
+	switch role {
+	case roleTitle:
+		return t.Title
+	case roleMuted:
+		return t.Muted
+	case roleAccent:
+		return t.Accent
+	default:
+		return t.Text
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 //go:embed assets/*
@@ -12,12 +18,195 @@ var assets embed.FS
 func main() {
 	logoPath := flag.String("logo", "", "Logo图片路径，支持PNG/JPEG格式，留空使用内嵌logo")
 	port := flag.String("port", "9000", "服务器端口")
+	geoDBPath := flag.String("geodb", "", "本地MMDB地理位置数据库路径（MaxMind/DB-IP格式），City 和 ASN 库可用逗号分隔同时指定，留空使用在线查询")
+	geoDBReload := flag.Duration("geodb-reload", time.Minute, "检查数据库文件更新的间隔，0为不自动重新加载")
+	geoFallback := flag.Bool("geo-fallback", false, "本地数据库查不到时是否回退到在线查询")
+	geoProviders := flag.String("geo-providers", "", "地理位置数据源及顺序，逗号分隔，可选 mmdb,ipinfo,ip-api,ipapi.co,http")
+	ipinfoToken := flag.String("ipinfo-token", "", "ipinfo.io API token")
+	geoHTTPURL := flag.String("geo-http-url", "", "通用JSON数据源地址，{ip} 会被替换为查询的IP")
+	geoHTTPFields := flag.String("geo-http-fields", "", "通用JSON数据源字段映射，如 country=country_code,region=region,city=city,org=org")
+	geoCooldown := flag.Duration("geo-cooldown", time.Minute, "数据源连续失败后暂停使用的时间")
+	geoMaxFailures := flag.Int("geo-max-failures", 3, "数据源连续失败多少次后进入冷却")
+	geoTimeout := flag.Duration("geo-timeout", 5*time.Second, "单次地理位置查询的超时时间")
+	cacheSize := flag.Int("cache-size", 10000, "地理位置缓存最多保存的IP数量")
+	cacheTTL := flag.Duration("cache-ttl", 24*time.Hour, "地理位置查询成功的缓存时间")
+	cacheNegativeTTL := flag.Duration("cache-negative-ttl", 5*time.Minute, "地理位置查询失败的缓存时间，0为不缓存失败结果")
+	cacheFile := flag.String("cache-file", "", "缓存快照文件，关闭时保存、启动时恢复，留空不持久化")
+	trustedProxies := flag.String("trusted-proxies", "127.0.0.0/8,::1", "可信代理的IP或CIDR，逗号分隔，只有来自这些地址的请求才读取代理头")
+	proxyHeader := flag.String("proxy-header", "xff", "可信代理写入客户端地址的请求头，可选 xff（X-Forwarded-For）,forwarded,x-real-ip，只读取该头")
+	trustCloudflare := flag.Bool("trust-cloudflare", false, "将 Cloudflare 的IP段加入可信代理")
+	theme := flag.String("theme", "dark", "默认主题，可选 dark,light,solarized,high-contrast,auto 或自定义主题名")
+	themePaths := flag.String("themes", "", "自定义主题文件或目录（JSON/YAML），逗号分隔")
+	fontPaths := flag.String("font", "", "PNG使用的字体文件（TTF/OTF/TTC），逗号分隔按顺序回退，go 表示内置字体；内置字体没有中日文字形，未指定时 zh、ja 的位图卡片改用英文")
+	lang := flag.String("lang", "zh", "默认语言，可选 zh,en,ja,ru，请求可通过 Accept-Language 或 ?lang= 指定")
+	timeZone := flag.String("tz", "", "IP 没有时区信息时使用的时区，如 Asia/Shanghai，留空使用服务器本地时区")
+	jpegQuality := flag.Int("jpeg-quality", 90, "JPEG 默认质量（1-100），请求可通过 ?quality= 覆盖")
+	gifColors := flag.Int("gif-colors", 256, "GIF 调色板颜色数（2-256）")
+	pngCompression := flag.String("png-compression", "default", "PNG 压缩级别，可选 default,speed,best,none")
+	pngBufferPool := flag.Bool("png-buffer-pool", true, "复用 PNG 编码缓冲区，减少内存分配")
+	cachePolicy := flag.String("cache-policy", "private", "卡片响应的缓存策略，可选 private,public,no-store（用作访问统计像素时）")
+	cacheMaxAge := flag.Duration("cache-max-age", time.Minute, "卡片响应的缓存时间")
+	rateLimit := flag.Float64("rate-limit", 5, "每个客户端每秒允许的请求数，0为不限制")
+	rateBurst := flag.Int("rate-burst", 20, "每个客户端允许的突发请求数")
+	rateIPv4Prefix := flag.Int("rate-limit-ipv4-prefix", 32, "按网段限流时IPv4的前缀长度，32为按单个地址")
+	rateIPv6Prefix := flag.Int("rate-limit-ipv6-prefix", 64, "按网段限流时IPv6的前缀长度")
+	rateStatus := flag.Int("rate-limit-status", 429, "超出限制时返回的状态码")
+	rateMessage := flag.String("rate-limit-message", "请求过于频繁，请稍后再试", "超出限制时返回的错误信息")
+	geoRate := flag.Float64("geo-rate", 0, "在线数据源每秒最多查询次数（所有客户端共享），0为不限制，用完时卡片显示地区暂不可用")
+	geoBurst := flag.Int("geo-burst", 10, "在线数据源允许的突发查询次数")
+	metricsAddr := flag.String("metrics-addr", "", "Prometheus 监控指标的监听地址，如 127.0.0.1:9100，留空不提供")
+	metricsPublic := flag.Bool("metrics-public", false, "在服务端口的 /metrics 上公开提供监控指标，与 -metrics-addr 只能设置一个")
+	readTimeout := flag.Duration("read-timeout", 10*time.Second, "读取整个请求的超时时间")
+	readHeaderTimeout := flag.Duration("read-header-timeout", 5*time.Second, "读取请求头的超时时间")
+	writeTimeout := flag.Duration("write-timeout", 30*time.Second, "写响应的超时时间，需大于 -geo-timeout")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "keep-alive 连接的空闲超时时间")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 15*time.Second, "收到 SIGTERM/SIGINT 后等待进行中请求完成的最长时间")
+	tlsCert := flag.String("tls-cert", "", "HTTPS 证书文件（PEM），与 -tls-key 同时配置后服务端口使用 HTTPS 并启用 HTTP/2")
+	tlsKey := flag.String("tls-key", "", "HTTPS 私钥文件（PEM）")
+	tlsRedirectAddr := flag.String("tls-redirect-addr", "", "HTTP 跳转到 HTTPS 的监听地址，如 :80，留空不监听")
+	tlsReload := flag.Duration("tls-reload", time.Minute, "检查证书文件更新的间隔，0为不自动重新加载")
+	corsOrigins := flag.String("cors-origins", "*", "允许跨域访问的来源，逗号分隔，如 https://example.com，* 为允许所有来源")
+	accessLog := flag.Bool("access-log", true, "是否输出访问日志")
+	configPath := flag.String("config", "", "配置文件（YAML/JSON/TOML），优先级低于环境变量（IP_ 加大写参数名，如 IP_GEO_TIMEOUT）和命令行参数")
+	printCfg := flag.Bool("print-config", false, "输出合并配置文件、环境变量和命令行参数后的配置并退出")
 	flag.Parse()
 
+	if *configPath == "" {
+		*configPath = os.Getenv(envName("config"))
+	}
+	sources, err := applyConfig(flag.CommandLine, *configPath)
+	if err != nil {
+		log.Fatal("配置错误:", err)
+	}
+	if *printCfg {
+		if err := printConfig(os.Stdout, flag.CommandLine, sources); err != nil {
+			log.Fatal("输出配置失败:", err)
+		}
+		return
+	}
+
 	server := NewServer(assets)
 	server.LoadLogo(*logoPath)
+	if *fontPaths != "" {
+		if err := server.LoadFonts(strings.Split(*fontPaths, ",")); err != nil {
+			log.Fatal("字体配置错误:", err)
+		}
+	}
+	if err := server.LoadThemes(strings.Split(*themePaths, ",")); err != nil {
+		log.Fatal("主题配置错误:", err)
+	}
+	if err := server.SetDefaultTheme(*theme); err != nil {
+		log.Fatal("主题配置错误:", err)
+	}
+	if err := server.SetDefaultLang(*lang); err != nil {
+		log.Fatal("语言配置错误:", err)
+	}
+	if err := server.checkFontCoverage(); err != nil {
+		log.Printf("%v，需要该语言的位图卡片请用 -font 指定包含这些字形的字体", err)
+	}
+	if err := server.SetDefaultTimeZone(*timeZone); err != nil {
+		log.Fatal("时区配置错误:", err)
+	}
+	compression, err := ParsePNGCompression(*pngCompression)
+	if err != nil {
+		log.Fatal("图像配置错误:", err)
+	}
+	if err := server.SetupImage(ImageOptions{
+		JPEGQuality:    *jpegQuality,
+		GIFColors:      *gifColors,
+		PNGCompression: compression,
+		PNGBufferPool:  *pngBufferPool,
+	}); err != nil {
+		log.Fatal("图像配置错误:", err)
+	}
+	if err := server.SetCachePolicy(CachePolicy{Mode: *cachePolicy, MaxAge: *cacheMaxAge}); err != nil {
+		log.Fatal("缓存策略配置错误:", err)
+	}
+	server.SetupCache(CacheOptions{
+		Size:        *cacheSize,
+		TTL:         *cacheTTL,
+		NegativeTTL: *cacheNegativeTTL,
+		File:        *cacheFile,
+	})
+	dbLoaded := server.LoadGeoDB(strings.Split(*geoDBPath, ","), *geoDBReload)
+
+	providers := *geoProviders
+	if providers == "" {
+		providers = providerIPInfo
+		if dbLoaded {
+			providers = providerMMDB
+			if *geoFallback {
+				providers += "," + providerIPInfo
+			}
+		}
+	}
+
+	fields, err := ParseFieldMap(*geoHTTPFields)
+	if err != nil {
+		log.Fatal("地理位置数据源配置错误:", err)
+	}
+	if err := server.SetupGeo(GeoOptions{
+		Providers:   strings.Split(providers, ","),
+		IPInfoToken: *ipinfoToken,
+		HTTPURL:     *geoHTTPURL,
+		HTTPFields:  fields,
+		Cooldown:    *geoCooldown,
+		MaxFailures: *geoMaxFailures,
+		Timeout:     *geoTimeout,
+	}); err != nil {
+		log.Fatal("地理位置数据源配置错误:", err)
+	}
+
+	if err := server.SetTrustedProxies(strings.Split(*trustedProxies, ","), *trustCloudflare); err != nil {
+		log.Fatal("可信代理配置错误:", err)
+	}
+	if err := server.SetProxyHeader(*proxyHeader); err != nil {
+		log.Fatal("可信代理配置错误:", err)
+	}
+	if err := server.SetupRateLimit(RateLimitOptions{
+		Rate:       *rateLimit,
+		Burst:      *rateBurst,
+		IPv4Prefix: *rateIPv4Prefix,
+		IPv6Prefix: *rateIPv6Prefix,
+		Status:     *rateStatus,
+		Message:    *rateMessage,
+		GeoRate:    *geoRate,
+		GeoBurst:   *geoBurst,
+	}); err != nil {
+		log.Fatal("限流配置错误:", err)
+	}
+	if err := server.SetupMetrics(MetricsOptions{Addr: *metricsAddr, Public: *metricsPublic}); err != nil {
+		log.Fatal("监控指标配置错误:", err)
+	}
+	server.SetCORSOrigins(strings.Split(*corsOrigins, ","))
+	server.SetAccessLog(*accessLog)
+	if err := server.SetServerOptions(ServerOptions{
+		ReadTimeout:       *readTimeout,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+		ShutdownTimeout:   *shutdownTimeout,
+	}); err != nil {
+		log.Fatal("服务器配置错误:", err)
+	}
+	if err := server.SetupTLS(TLSOptions{
+		CertFile:     *tlsCert,
+		KeyFile:      *tlsKey,
+		RedirectAddr: *tlsRedirectAddr,
+		Reload:       *tlsReload,
+	}); err != nil {
+		log.Fatal("TLS配置错误:", err)
+	}
+	server.PrepareStatic()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// 收到第一个信号后恢复默认处理，等待期间再按一次 Ctrl+C 直接退出
+	context.AfterFunc(ctx, stop)
 
-	if err := server.Run(*port); err != nil {
-		log.Fatal("服务器启动失败:", err)
+	err = server.Run(ctx, *port)
+	server.Close()
+	if err != nil {
+		log.Fatal("服务器运行失败:", err)
 	}
-} 
\ No newline at end of file
+}
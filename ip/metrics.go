@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Prometheus 文本格式的监控指标，指标较少，直接输出而不引入客户端库
+
+// 直方图的桶上限（秒）
+var (
+	renderBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+	lookupBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// metrics 运行指标，计数器只增不减，进程重启后归零
+type metrics struct {
+	mu           sync.Mutex
+	requests     map[requestKey]uint64 // 按格式和状态码统计的请求数
+	render       map[string]*histogram // 各格式的渲染耗时
+	lookups      map[string]*histogram // 各数据源的查询耗时
+	lookupErrors map[string]uint64     // 各数据源的查询失败次数
+
+	rateLimited   atomic.Uint64 // 被限流的请求数
+	budgetSkipped atomic.Uint64 // 因预算用完跳过的在线查询次数
+	canvasCreated atomic.Uint64 // 新建的画布数
+	canvasInUse   atomic.Int64  // 正在使用的画布数
+}
+
+type requestKey struct {
+	format string
+	status int
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64 // 与 buckets 对应，不累加
+	sum     float64
+	count   uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:     make(map[requestKey]uint64),
+		render:       make(map[string]*histogram),
+		lookups:      make(map[string]*histogram),
+		lookupErrors: make(map[string]uint64),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func observe(m map[string]*histogram, buckets []float64, key string, d time.Duration) {
+	h, ok := m[key]
+	if !ok {
+		h = &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		m[key] = h
+	}
+	h.observe(d.Seconds())
+}
+
+func (m *metrics) countRequest(format string, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestKey{format, status}]++
+}
+
+func (m *metrics) observeRender(format string, start time.Time) {
+	d := time.Since(start)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observe(m.render, renderBuckets, format, d)
+}
+
+// observeLookup 记录一次数据源查询，失败的查询同样计入耗时
+func (m *metrics) observeLookup(provider string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	observe(m.lookups, lookupBuckets, provider, d)
+	if err != nil {
+		m.lookupErrors[provider]++
+	}
+}
+
+// metricsMiddleware 统计 /api 下的请求，格式由处理函数写入上下文，
+// 被限流等提前结束的请求按协商结果计算
+func (s *Server) metricsMiddleware(c *gin.Context) {
+	c.Next()
+	format := c.GetString("format")
+	if format == "" {
+		format = negotiateFormat(c.Request)
+	}
+	s.metrics.countRequest(format, c.Writer.Status())
+}
+
+// metricsHandler 输出 Prometheus 文本格式的指标
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writeMetrics(w)
+}
+
+func (s *Server) writeMetrics(w io.Writer) {
+	m := s.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeHeader(w, "ip_http_requests_total", "counter", "按输出格式和状态码统计的 /api 请求数")
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].format != keys[j].format {
+			return keys[i].format < keys[j].format
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "ip_http_requests_total{format=%q,status=\"%d\"} %d\n", k.format, k.status, m.requests[k])
+	}
+
+	writeHeader(w, "ip_render_duration_seconds", "histogram", "各格式卡片的渲染和编码耗时")
+	writeHistograms(w, "ip_render_duration_seconds", "format", m.render)
+
+	stats := s.cache.Stats()
+	writeHeader(w, "ip_geo_cache_hits_total", "counter", "地理位置缓存命中次数")
+	fmt.Fprintf(w, "ip_geo_cache_hits_total %d\n", stats.Hits)
+	writeHeader(w, "ip_geo_cache_misses_total", "counter", "地理位置缓存未命中次数")
+	fmt.Fprintf(w, "ip_geo_cache_misses_total %d\n", stats.Misses)
+	writeHeader(w, "ip_geo_cache_entries", "gauge", "地理位置缓存条目数")
+	fmt.Fprintf(w, "ip_geo_cache_entries %d\n", stats.Size)
+
+	writeHeader(w, "ip_geo_lookup_duration_seconds", "histogram", "各地理位置数据源的查询耗时")
+	writeHistograms(w, "ip_geo_lookup_duration_seconds", "provider", m.lookups)
+	writeHeader(w, "ip_geo_lookup_errors_total", "counter", "各地理位置数据源的查询失败次数")
+	for _, p := range sortedKeys(m.lookupErrors) {
+		fmt.Fprintf(w, "ip_geo_lookup_errors_total{provider=%q} %d\n", p, m.lookupErrors[p])
+	}
+	writeHeader(w, "ip_geo_provider_available", "gauge", "各地理位置数据源是否可用，0 为连续失败后处于冷却期")
+	for _, p := range s.geo.providers {
+		available := 0
+		if p.available(s.geo.now()) {
+			available = 1
+		}
+		fmt.Fprintf(w, "ip_geo_provider_available{provider=%q} %d\n", p.Name(), available)
+	}
+	writeHeader(w, "ip_geo_budget_skipped_total", "counter", "在线查询预算用完而跳过的查询次数")
+	fmt.Fprintf(w, "ip_geo_budget_skipped_total %d\n", m.budgetSkipped.Load())
+
+	writeHeader(w, "ip_rate_limited_total", "counter", "被限流拒绝的请求数")
+	fmt.Fprintf(w, "ip_rate_limited_total %d\n", m.rateLimited.Load())
+
+	writeHeader(w, "ip_canvas_pools", "gauge", "画布池数量，每种卡片尺寸一个")
+	fmt.Fprintf(w, "ip_canvas_pools %d\n", s.poolCount.Load())
+	writeHeader(w, "ip_canvas_pool_limit", "gauge", "画布池数量上限，超出的尺寸每次新建画布")
+	fmt.Fprintf(w, "ip_canvas_pool_limit %d\n", maxCanvasPools)
+	writeHeader(w, "ip_canvas_in_use", "gauge", "正在绘制的画布数")
+	fmt.Fprintf(w, "ip_canvas_in_use %d\n", m.canvasInUse.Load())
+	writeHeader(w, "ip_canvas_created_total", "counter", "新建的画布数，持续增长说明池中的画布不够用或尺寸过多")
+	fmt.Fprintf(w, "ip_canvas_created_total %d\n", m.canvasCreated.Load())
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeHistograms 输出直方图，桶计数按 Prometheus 的要求累加
+func writeHistograms(w io.Writer, name, label string, hs map[string]*histogram) {
+	for _, key := range sortedKeys(hs) {
+		h := hs[key]
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s=%q,le=%q} %d\n", name, label, key, strconv.FormatFloat(le, 'g', -1, 64), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s=%q,le=\"+Inf\"} %d\n", name, label, key, h.count)
+		fmt.Fprintf(w, "%s_sum{%s=%q} %s\n", name, label, key, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s=%q} %d\n", name, label, key, h.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MetricsOptions 监控指标的提供方式，都不设置时不提供 /metrics
+type MetricsOptions struct {
+	Addr   string // 单独的监听地址，如 127.0.0.1:9100
+	Public bool   // 在服务端口上提供 /metrics，所有能访问服务的人都能看到
+}
+
+// SetupMetrics 设置监控指标的提供方式
+func (s *Server) SetupMetrics(opts MetricsOptions) error {
+	if opts.Addr != "" && opts.Public {
+		return errors.New("-metrics-addr 与 -metrics-public 只能设置一个")
+	}
+	s.metricsOpts = opts
+	if opts.Public {
+		log.Printf("监控指标在服务端口的 /metrics 上公开提供")
+	}
+	return nil
+}
+
+// serveMetrics 在单独的地址上提供 /metrics，不经过公开端口，返回的服务随主服务一起关闭
+func (s *Server) serveMetrics(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.metricsHandler)
+	srv := s.newHTTPServer(addr, mux)
+	log.Printf("监控指标: %s/metrics", addr)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("监控指标服务启动失败: %v", err)
+		}
+	}()
+	return srv
+}
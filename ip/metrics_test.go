@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsExposure(t *testing.T) {
+	get := func(s *Server) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.router().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return w
+	}
+
+	s, _ := testServer(t)
+	if w := get(s); w.Code != http.StatusNotFound {
+		t.Errorf("默认不应在服务端口上提供 /metrics: %d", w.Code)
+	}
+	if err := s.SetupMetrics(MetricsOptions{Addr: "127.0.0.1:9100"}); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(s); w.Code != http.StatusNotFound {
+		t.Errorf("指定单独地址时不应在服务端口上提供 /metrics: %d", w.Code)
+	}
+
+	if err := s.SetupMetrics(MetricsOptions{Public: true}); err != nil {
+		t.Fatal(err)
+	}
+	if w := get(s); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ip_geo_cache_entries") {
+		t.Errorf("开启 -metrics-public 后应提供 /metrics: %d", w.Code)
+	}
+
+	if err := s.SetupMetrics(MetricsOptions{Addr: "127.0.0.1:9100", Public: true}); err == nil {
+		t.Error("同时设置两者应返回错误")
+	}
+}
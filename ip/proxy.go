@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cloudflareRanges Cloudflare 公布的回源 IP 段，见 https://www.cloudflare.com/ips/
+var cloudflareRanges = []string{
+	"173.245.48.0/20",
+	"103.21.244.0/22",
+	"103.22.200.0/22",
+	"103.31.4.0/22",
+	"141.101.64.0/18",
+	"108.162.192.0/18",
+	"190.93.240.0/20",
+	"188.114.96.0/20",
+	"197.234.240.0/22",
+	"198.41.128.0/17",
+	"162.158.0.0/15",
+	"104.16.0.0/13",
+	"104.24.0.0/14",
+	"172.64.0.0/13",
+	"131.0.72.0/22",
+	"2400:cb00::/32",
+	"2606:4700::/32",
+	"2803:f800::/32",
+	"2405:b500::/32",
+	"2405:8100::/32",
+	"2a06:98c0::/29",
+	"2c0f:f248::/32",
+}
+
+// 可信代理写入客户端地址的请求头，只读取配置的一种，其余的可能由客户端伪造后被代理原样转发
+const (
+	proxyHeaderXFF       = "xff"       // X-Forwarded-For，nginx 的 $proxy_add_x_forwarded_for 等
+	proxyHeaderForwarded = "forwarded" // RFC 7239 Forwarded
+	proxyHeaderRealIP    = "x-real-ip" // X-Real-IP，代理覆盖为直连地址，如 nginx 的 $remote_addr
+)
+
+var proxyHeaderNames = map[string]string{
+	proxyHeaderXFF:       "X-Forwarded-For",
+	proxyHeaderForwarded: "Forwarded",
+	proxyHeaderRealIP:    "X-Real-IP",
+}
+
+// trustedProxies 可信代理网段，只有直连对端在其中时才读取代理头
+type trustedProxies struct {
+	prefixes []netip.Prefix
+}
+
+// parseTrustedProxies 解析 CIDR 或单个 IP 列表
+func parseTrustedProxies(list []string) (*trustedProxies, error) {
+	t := &trustedProxies{}
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("无效的代理地址: %s", item)
+			}
+			addr = addr.Unmap()
+			t.prefixes = append(t.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的代理网段: %s", item)
+		}
+		t.prefixes = append(t.prefixes, prefix.Masked())
+	}
+	return t, nil
+}
+
+func (t *trustedProxies) contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTrustedProxies 设置可信代理列表，cloudflare 为 true 时追加 Cloudflare 的 IP 段，
+// 并且只有直连对端属于 Cloudflare 时才读取 CF-Connecting-IP
+func (s *Server) SetTrustedProxies(list []string, cloudflare bool) error {
+	s.cloudflare = nil
+	if cloudflare {
+		list = append(list, cloudflareRanges...)
+		s.cloudflare, _ = parseTrustedProxies(cloudflareRanges)
+	}
+	proxies, err := parseTrustedProxies(list)
+	if err != nil {
+		return err
+	}
+	s.proxies = proxies
+	return nil
+}
+
+// SetProxyHeader 设置从哪个请求头读取客户端地址，可选 xff、forwarded、x-real-ip
+func (s *Server) SetProxyHeader(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := proxyHeaderNames[name]; !ok {
+		return fmt.Errorf("不支持的代理头: %s，可选 xff,forwarded,x-real-ip", name)
+	}
+	s.proxyHeader = name
+	return nil
+}
+
+// proxyHeaders getClientIP 会读取的代理头，响应随这些头变化
+func (s *Server) proxyHeaders() []string {
+	headers := []string{proxyHeaderNames[s.proxyHeader]}
+	if s.cloudflare != nil {
+		headers = append(headers, "CF-Connecting-IP")
+	}
+	return headers
+}
+
+// walkHops 从右往左跳过可信代理，返回第一个不可信的地址。
+// hops 为代理头中按顺序记录的地址，peer 为直连对端
+func (t *trustedProxies) walkHops(hops []string, peer string) string {
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !t.contains(client) {
+			break
+		}
+		hop := normalizeIP(hops[i])
+		if hop == "" {
+			break
+		}
+		client = hop
+	}
+	return client
+}
+
+// normalizeIP 去掉端口、方括号和引号，无效地址返回空字符串
+func normalizeIP(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return ""
+	}
+	return addr.Unmap().String()
+}
+
+// parseForwarded 按 RFC 7239 解析 Forwarded 头，返回各段 for= 的值
+func parseForwarded(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			var forValue string
+			for _, pair := range splitQuoted(element, ';') {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(key), "for") {
+					forValue = strings.TrimSpace(val)
+				}
+			}
+			// 没有 for= 的段也占一跳，按无效地址处理
+			hops = append(hops, forValue)
+		}
+	}
+	return hops
+}
+
+// splitQuoted 按分隔符拆分，忽略双引号内的分隔符
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	inQuote := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			inQuote = !inQuote
+		case sep:
+			if !inQuote {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func splitList(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	return hops
+}
+
+func (s *Server) getClientIP(c *gin.Context) string {
+	peer, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		peer = c.Request.RemoteAddr
+	}
+	peer = strings.TrimSpace(peer)
+	if ip := normalizeIP(peer); ip != "" {
+		peer = ip
+	}
+
+	// 直连对端不可信时忽略所有代理头，防止伪造
+	if !s.proxies.contains(peer) {
+		return peer
+	}
+
+	// CF-Connecting-IP 只有一个地址，无法区分是 Cloudflare 写入的还是客户端伪造后
+	// 经其他代理原样转发的，只在直连对端就是 Cloudflare 时读取
+	header := c.Request.Header
+	if s.cloudflare != nil && s.cloudflare.contains(peer) {
+		if ip := normalizeIP(header.Get("CF-Connecting-IP")); ip != "" {
+			return ip
+		}
+	}
+
+	// 只读取可信代理写入的头。代理通常只追加 X-Forwarded-For 而原样转发 Forwarded，
+	// 读取其他头或在缺少时回退到其他头都会让客户端伪造地址
+	switch s.proxyHeader {
+	case proxyHeaderForwarded:
+		return s.proxies.walkHops(parseForwarded(header.Values("Forwarded")), peer)
+	case proxyHeaderRealIP:
+		if ip := normalizeIP(header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		return peer
+	default:
+		// 多跳代理头从右往左跳过可信代理，客户端自己写入的地址在最左边，不会被取到
+		return s.proxies.walkHops(splitList(header.Values("X-Forwarded-For")), peer)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseForwarded(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"单段", []string{"for=192.0.2.60;proto=http;by=203.0.113.43"}, []string{"192.0.2.60"}},
+		{"多段", []string{"for=192.0.2.43, for=198.51.100.17"}, []string{"192.0.2.43", "198.51.100.17"}},
+		{"多个头", []string{"for=192.0.2.43", "for=198.51.100.17"}, []string{"192.0.2.43", "198.51.100.17"}},
+		{"IPv6 带引号和端口", []string{`for="[2001:db8:cafe::17]:4711"`}, []string{`"[2001:db8:cafe::17]:4711"`}},
+		{"键不区分大小写", []string{"For=192.0.2.1"}, []string{"192.0.2.1"}},
+		{"引号内的分隔符", []string{`for="a,b;c", for=192.0.2.2`}, []string{`"a,b;c"`, "192.0.2.2"}},
+		{"没有 for 的段占一跳", []string{"proto=https, for=192.0.2.3"}, []string{"", "192.0.2.3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseForwarded(tt.values); !slices.Equal(got, tt.want) {
+				t.Errorf("parseForwarded(%q) = %q，期望 %q", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkHops(t *testing.T) {
+	proxies, err := parseTrustedProxies([]string{"127.0.0.0/8", "10.0.0.0/8", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		hops []string
+		peer string
+		want string
+	}{
+		{"对端不可信", []string{"203.0.113.9"}, "198.51.100.1", "198.51.100.1"},
+		{"单跳", []string{"203.0.113.9"}, "127.0.0.1", "203.0.113.9"},
+		{"跳过可信代理", []string{"203.0.113.9", "10.0.0.2", "10.0.0.1"}, "127.0.0.1", "203.0.113.9"},
+		{"左边伪造的地址不会被取到", []string{"6.6.6.6", "203.0.113.9"}, "127.0.0.1", "203.0.113.9"},
+		{"全部可信时取最左边", []string{"10.0.0.3", "10.0.0.2"}, "127.0.0.1", "10.0.0.3"},
+		{"无效地址停在上一跳", []string{"203.0.113.9", "garbage", "10.0.0.1"}, "127.0.0.1", "10.0.0.1"},
+		{"带端口和方括号", []string{"[2001:db9::1]:443", "2001:db8::1"}, "127.0.0.1", "2001:db9::1"},
+		{"IPv4 映射地址", []string{"::ffff:203.0.113.9"}, "::ffff:127.0.0.1", "203.0.113.9"},
+		{"没有代理头", nil, "127.0.0.1", "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := proxies.walkHops(tt.hops, tt.peer); got != tt.want {
+				t.Errorf("walkHops(%q, %s) = %s，期望 %s", tt.hops, tt.peer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetClientIP(t *testing.T) {
+	const cfPeer = "173.245.48.1:443"
+	tests := []struct {
+		name       string
+		peer       string
+		header     string
+		cloudflare bool
+		headers    map[string]string
+		want       string
+	}{
+		{"不可信对端忽略代理头", "198.51.100.1:5000", proxyHeaderXFF, false,
+			map[string]string{"X-Forwarded-For": "6.6.6.6", "X-Real-IP": "6.6.6.6"}, "198.51.100.1"},
+		{"本机代理转发的 CF-Connecting-IP 不可信", "127.0.0.1:5000", proxyHeaderXFF, false,
+			map[string]string{"CF-Connecting-IP": "6.6.6.6", "X-Forwarded-For": "6.6.6.6, 203.0.113.9"}, "203.0.113.9"},
+		{"开启 Cloudflare 后本机代理仍按 X-Forwarded-For", "127.0.0.1:5000", proxyHeaderXFF, true,
+			map[string]string{"CF-Connecting-IP": "6.6.6.6", "X-Forwarded-For": "6.6.6.6, 203.0.113.9"}, "203.0.113.9"},
+		{"未开启 Cloudflare 时忽略 CF-Connecting-IP", "127.0.0.1:5000", proxyHeaderXFF, false,
+			map[string]string{"CF-Connecting-IP": "6.6.6.6"}, "127.0.0.1"},
+		{"Cloudflare 直连时读取 CF-Connecting-IP", cfPeer, proxyHeaderXFF, true,
+			map[string]string{"CF-Connecting-IP": "203.0.113.9", "X-Forwarded-For": "6.6.6.6, 203.0.113.9"}, "203.0.113.9"},
+		{"Cloudflare 回源经本机代理", "127.0.0.1:5000", proxyHeaderXFF, true,
+			map[string]string{"X-Forwarded-For": "6.6.6.6, 203.0.113.9, 173.245.48.1"}, "203.0.113.9"},
+		{"未开启 Cloudflare 时 Cloudflare 地址不可信", cfPeer, proxyHeaderXFF, false,
+			map[string]string{"CF-Connecting-IP": "203.0.113.9"}, "173.245.48.1"},
+		{"代理追加 X-Forwarded-For 时忽略伪造的 Forwarded", "127.0.0.1:5000", proxyHeaderXFF, false,
+			map[string]string{"Forwarded": "for=6.6.6.6", "X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"缺少 X-Forwarded-For 时不回退到 Forwarded", "127.0.0.1:5000", proxyHeaderXFF, false,
+			map[string]string{"Forwarded": "for=6.6.6.6"}, "127.0.0.1"},
+		{"X-Forwarded 不读取", "127.0.0.1:5000", proxyHeaderXFF, false,
+			map[string]string{"X-Forwarded": "6.6.6.6"}, "127.0.0.1"},
+		{"X-Client-IP 不读取", "127.0.0.1:5000", proxyHeaderXFF, false,
+			map[string]string{"X-Client-IP": "6.6.6.6", "X-Cluster-Client-IP": "6.6.6.6"}, "127.0.0.1"},
+		{"按 X-Forwarded-For 时忽略 X-Real-IP", "127.0.0.1:5000", proxyHeaderXFF, false,
+			map[string]string{"X-Real-IP": "6.6.6.6"}, "127.0.0.1"},
+		{"代理写入 Forwarded", "127.0.0.1:5000", proxyHeaderForwarded, false,
+			map[string]string{"Forwarded": "for=6.6.6.6, for=203.0.113.9", "X-Forwarded-For": "6.6.6.6"}, "203.0.113.9"},
+		{"按 Forwarded 时忽略伪造的 X-Forwarded-For", "127.0.0.1:5000", proxyHeaderForwarded, false,
+			map[string]string{"X-Forwarded-For": "6.6.6.6"}, "127.0.0.1"},
+		{"代理覆盖 X-Real-IP", "127.0.0.1:5000", proxyHeaderRealIP, false,
+			map[string]string{"X-Real-IP": "203.0.113.9", "X-Forwarded-For": "6.6.6.6"}, "203.0.113.9"},
+		{"IPv6 对端", "[::1]:5000", proxyHeaderXFF, false,
+			map[string]string{"X-Forwarded-For": "2001:db8::9"}, "2001:db8::9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{}
+			if err := s.SetTrustedProxies([]string{"127.0.0.0/8", "::1"}, tt.cloudflare); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetProxyHeader(tt.header); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/api/ip", nil)
+			req.RemoteAddr = tt.peer
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = req
+			if got := s.getClientIP(c); got != tt.want {
+				t.Errorf("getClientIP = %s，期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetProxyHeader(t *testing.T) {
+	s := &Server{}
+	if err := s.SetProxyHeader(" Forwarded "); err != nil || s.proxyHeader != proxyHeaderForwarded {
+		t.Errorf("应忽略大小写和空白: %q, %v", s.proxyHeader, err)
+	}
+	if err := s.SetProxyHeader("x-forwarded"); err == nil {
+		t.Error("不支持的代理头应返回错误")
+	}
+	if got := s.proxyHeaders(); !slices.Equal(got, []string{"Forwarded"}) {
+		t.Errorf("proxyHeaders = %q", got)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// errGeoBudget 在线查询预算已用完，结果不缓存，卡片显示地区暂不可用
+var errGeoBudget = errors.New("在线查询预算已用完")
+
+// maxRateLimitClients 最多跟踪多少个客户端，防止伪造大量来源地址占满内存
+const maxRateLimitClients = 100000
+
+// RateLimitOptions 请求限流和在线查询预算配置
+type RateLimitOptions struct {
+	Rate       float64 // 每个客户端每秒允许的请求数，0 为不限制
+	Burst      int     // 每个客户端允许的突发请求数
+	IPv4Prefix int     // 按网段限流时 IPv4 的前缀长度，32 为单个地址
+	IPv6Prefix int     // IPv6 的前缀长度，默认 64，同一用户通常拥有整个 /64
+	Status     int     // 超出限制时的状态码
+	Message    string  // 超出限制时返回的错误信息
+	GeoRate    float64 // 所有在线数据源每秒最多查询次数，0 为不限制，本地数据库不受限制
+	GeoBurst   int     // 在线查询允许的突发次数
+}
+
+// SetupRateLimit 设置请求限流和在线查询预算
+func (s *Server) SetupRateLimit(opts RateLimitOptions) error {
+	if opts.Rate < 0 || opts.GeoRate < 0 {
+		return errors.New("限流速率不能为负数")
+	}
+	if opts.Rate > 0 && opts.Burst < 1 || opts.GeoRate > 0 && opts.GeoBurst < 1 {
+		return errors.New("突发请求数至少为 1")
+	}
+	if opts.IPv4Prefix < 0 || opts.IPv4Prefix > 32 || opts.IPv6Prefix < 0 || opts.IPv6Prefix > 128 {
+		return fmt.Errorf("无效的网段前缀长度: /%d、/%d", opts.IPv4Prefix, opts.IPv6Prefix)
+	}
+	if opts.Status < 400 || opts.Status > 599 {
+		return fmt.Errorf("限流状态码应为 4xx 或 5xx: %d", opts.Status)
+	}
+
+	s.limiter = nil
+	if opts.Rate > 0 {
+		s.limiter = newClientLimiter(opts)
+		go s.limiter.sweep(time.Minute)
+		log.Printf("请求限流: 每个客户端 %g 次/秒，突发 %d 次，按 IPv4 /%d、IPv6 /%d 网段计算",
+			opts.Rate, opts.Burst, opts.IPv4Prefix, opts.IPv6Prefix)
+	}
+
+	s.geoBudget = nil
+	if opts.GeoRate > 0 {
+		s.geoBudget = rate.NewLimiter(rate.Limit(opts.GeoRate), opts.GeoBurst)
+		log.Printf("在线查询预算: %g 次/秒，突发 %d 次", opts.GeoRate, opts.GeoBurst)
+	}
+	s.geo.budget = s.geoBudget
+	return nil
+}
+
+// rateLimitMiddleware 按客户端 IP 或网段限流，超出时返回配置的状态码和 Retry-After
+func (s *Server) rateLimitMiddleware(c *gin.Context) {
+	if s.limiter == nil {
+		c.Next()
+		return
+	}
+	ok, wait := s.limiter.allow(s.getClientIP(c))
+	if ok {
+		c.Next()
+		return
+	}
+	s.metrics.rateLimited.Add(1)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatusJSON(s.limiter.status, gin.H{"error": s.limiter.message})
+}
+
+// clientLimiter 每个客户端（或网段）一个令牌桶
+type clientLimiter struct {
+	mu         sync.Mutex
+	clients    map[string]*clientBucket
+	maxClients int
+	rate       rate.Limit
+	burst      int
+	v4, v6     int
+	status     int
+	message    string
+	now        func() time.Time // 测试时替换
+}
+
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newClientLimiter(opts RateLimitOptions) *clientLimiter {
+	return &clientLimiter{
+		clients:    make(map[string]*clientBucket),
+		maxClients: maxRateLimitClients,
+		rate:       rate.Limit(opts.Rate),
+		burst:      opts.Burst,
+		v4:         opts.IPv4Prefix,
+		v6:         opts.IPv6Prefix,
+		status:     opts.Status,
+		message:    opts.Message,
+		now:        time.Now,
+	}
+}
+
+// key 将 IP 转换为所在网段，无法解析时按原字符串计算
+func (l *clientLimiter) key(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := l.v6
+	if addr.Is4() {
+		bits = l.v4
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// allow 消耗一个令牌，令牌不足时返回需要等待的时间
+func (l *clientLimiter) allow(ip string) (bool, time.Duration) {
+	key := l.key(ip)
+	now := l.now()
+
+	l.mu.Lock()
+	b, ok := l.clients[key]
+	if !ok {
+		if len(l.clients) >= l.maxClients {
+			l.evictLocked(now)
+		}
+		b = &clientBucket{limiter: rate.NewLimiter(l.rate, l.burst)}
+		l.clients[key] = b
+	}
+	b.lastSeen = now
+	l.mu.Unlock()
+
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// idle 令牌桶恢复满所需的时间，超过这个时间没有请求的客户端可以删除
+func (l *clientLimiter) idle() time.Duration {
+	return max(time.Duration(float64(l.burst)/float64(l.rate)*float64(time.Second)), time.Minute)
+}
+
+// evictLocked 删除空闲的客户端，仍然已满时随机删除十分之一，
+// 避免持续伪造新地址时每个请求都遍历一次
+func (l *clientLimiter) evictLocked(now time.Time) {
+	idle := l.idle()
+	for key, b := range l.clients {
+		if now.Sub(b.lastSeen) > idle {
+			delete(l.clients, key)
+		}
+	}
+	n := len(l.clients) - l.maxClients*9/10
+	for key := range l.clients {
+		if n <= 0 {
+			return
+		}
+		delete(l.clients, key)
+		n--
+	}
+}
+
+// sweep 定期清理空闲的客户端
+func (l *clientLimiter) sweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		idle := l.idle()
+		l.mu.Lock()
+		for key, b := range l.clients {
+			if now.Sub(b.lastSeen) > idle {
+				delete(l.clients, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// isRemoteProvider 在线数据源消耗查询预算，本地数据库不受限制
+func isRemoteProvider(p GeoProvider) bool {
+	_, local := p.(*mmdbProvider)
+	return !local
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestLimiter(clock *fakeClock, opts RateLimitOptions) *clientLimiter {
+	l := newClientLimiter(opts)
+	l.now = clock.now
+	return l
+}
+
+func TestClientLimiterRefill(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(clock, RateLimitOptions{Rate: 2, Burst: 2, IPv4Prefix: 32, IPv6Prefix: 64})
+
+	for i := range 2 {
+		if ok, _ := l.allow("203.0.113.9"); !ok {
+			t.Fatalf("第 %d 次应在突发范围内", i+1)
+		}
+	}
+	ok, wait := l.allow("203.0.113.9")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("令牌用完后应拒绝并等待 500ms: %v, %s", ok, wait)
+	}
+
+	// 被拒绝的请求不消耗令牌
+	clock.advance(250 * time.Millisecond)
+	if ok, wait := l.allow("203.0.113.9"); ok || wait != 250*time.Millisecond {
+		t.Errorf("250ms 后仍应等待 250ms: %v, %s", ok, wait)
+	}
+	clock.advance(250 * time.Millisecond)
+	if ok, _ := l.allow("203.0.113.9"); !ok {
+		t.Error("补充一个令牌后应允许")
+	}
+	if ok, _ := l.allow("203.0.113.9"); ok {
+		t.Error("只补充了一个令牌")
+	}
+
+	// 空闲足够久后恢复到突发上限，不会无限累积
+	clock.advance(time.Hour)
+	for i := range 3 {
+		if ok, _ := l.allow("203.0.113.9"); ok != (i < 2) {
+			t.Errorf("空闲后第 %d 次: %v", i+1, ok)
+		}
+	}
+}
+
+func TestClientLimiterKey(t *testing.T) {
+	l := newClientLimiter(RateLimitOptions{Rate: 1, Burst: 1, IPv4Prefix: 24, IPv6Prefix: 64})
+	tests := []struct {
+		ip, want string
+	}{
+		{"203.0.113.9", "203.0.113.0/24"},
+		{"203.0.113.200", "203.0.113.0/24"},
+		{"203.0.114.1", "203.0.114.0/24"},
+		{"::ffff:203.0.113.9", "203.0.113.0/24"},
+		{"2001:db8:1:2::1", "2001:db8:1:2::/64"},
+		{"2001:db8:1:2:ffff:ffff:ffff:ffff", "2001:db8:1:2::/64"},
+		{"2001:db8:1:3::1", "2001:db8:1:3::/64"},
+		{"unknown", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := l.key(tt.ip); got != tt.want {
+			t.Errorf("key(%s) = %s，期望 %s", tt.ip, got, tt.want)
+		}
+	}
+
+	// 同一网段共享令牌桶，换地址不能绕过限制
+	clock := newFakeClock()
+	l.now = clock.now
+	for _, ip := range []string{"203.0.113.9", "2001:db8:1:2::1"} {
+		l.allow(ip)
+	}
+	for _, ip := range []string{"203.0.113.10", "2001:db8:1:2::abcd"} {
+		if ok, _ := l.allow(ip); ok {
+			t.Errorf("%s 与同网段的地址共享限额", ip)
+		}
+	}
+	for _, ip := range []string{"203.0.114.10", "2001:db8:1:3::1"} {
+		if ok, _ := l.allow(ip); !ok {
+			t.Errorf("%s 属于其他网段，不应受限", ip)
+		}
+	}
+}
+
+func TestClientLimiterEviction(t *testing.T) {
+	clock := newFakeClock()
+	l := newTestLimiter(clock, RateLimitOptions{Rate: 1, Burst: 1, IPv4Prefix: 32, IPv6Prefix: 64})
+	l.maxClients = 10
+
+	// 表满时先删除空闲的客户端
+	for i := range 5 {
+		l.allow(fmt.Sprintf("198.51.100.%d", i))
+	}
+	clock.advance(l.idle() + time.Second)
+	for i := range 5 {
+		l.allow(fmt.Sprintf("203.0.113.%d", i))
+	}
+	l.allow("192.0.2.1")
+	if n := len(l.clients); n != 6 {
+		t.Errorf("删除空闲客户端后应剩 6 个，实际 %d", n)
+	}
+	if _, ok := l.clients["198.51.100.0/32"]; ok {
+		t.Error("空闲的客户端应被删除")
+	}
+	if _, ok := l.clients["203.0.113.0/32"]; !ok {
+		t.Error("活跃的客户端不应被删除")
+	}
+
+	// 都不空闲时删除到九成再加入
+	for i := range 4 {
+		l.allow(fmt.Sprintf("192.0.2.%d", i+10))
+	}
+	if n := len(l.clients); n != 10 {
+		t.Fatalf("应有 10 个客户端，实际 %d", n)
+	}
+	l.allow("192.0.2.100")
+	if n := len(l.clients); n != 10 {
+		t.Errorf("表满时应删除到 9 个再加入，实际 %d", n)
+	}
+	if _, ok := l.clients["192.0.2.100/32"]; !ok {
+		t.Error("新客户端应加入")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	s, _ := testServer(t)
+	s.limiter = newClientLimiter(RateLimitOptions{Rate: 0.5, Burst: 1, IPv4Prefix: 32, IPv6Prefix: 64, Status: http.StatusServiceUnavailable, Message: "slow down"})
+
+	r := gin.New()
+	r.GET("/api/ip", s.rateLimitMiddleware, func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/ip", nil)
+		req.RemoteAddr = "203.0.113.9:5000"
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request(); w.Code != http.StatusOK {
+		t.Fatalf("第一次请求: %d", w.Code)
+	}
+	w := request()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("超出限制: %d，Retry-After %q，Cache-Control %q", w.Code, w.Header().Get("Retry-After"), w.Header().Get("Cache-Control"))
+	}
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["error"] != "slow down" {
+		t.Errorf("错误信息 %q, %v", w.Body.String(), err)
+	}
+	if n := s.metrics.rateLimited.Load(); n != 1 {
+		t.Errorf("ip_rate_limited_total = %d", n)
+	}
+}
+
+func TestGeoBudgetRegionBusy(t *testing.T) {
+	s, _ := testServer(t)
+	city := writeTestMMDB(t, "GeoLite2-City", map[string]any{"country": map[string]any{"iso_code": "JP"}})
+	if !s.LoadGeoDB([]string{city}, 0) {
+		t.Fatal("加载测试数据库失败")
+	}
+	remote := &stubProvider{name: "ipinfo", info: &GeoInfo{Country: "AU"}}
+	// 本地数据库只包含 0.0.0.0/1，其余地址需要在线查询
+	s.geo = newGeoChain([]GeoProvider{&mmdbProvider{db: s.geoDB}, remote}, time.Minute, 3)
+	s.geo.metrics = s.metrics
+	if err := s.SetupRateLimit(RateLimitOptions{Status: http.StatusTooManyRequests, GeoRate: 0.001, GeoBurst: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	location := func(peer string) string {
+		t.Helper()
+		w := serveCard(s, "/api/ip.json?lang=en", peer, nil)
+		var resp ipResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Location
+	}
+
+	if loc := location("203.0.113.9:5000"); loc != "Australia" {
+		t.Errorf("预算内应在线查询: %q", loc)
+	}
+	if loc := location("198.51.100.7:5000"); loc != catalogs["en"].RegionBusy {
+		t.Errorf("预算用完时应显示 %q，实际 %q", catalogs["en"].RegionBusy, loc)
+	}
+	if n := remote.calls.Load(); n != 1 {
+		t.Errorf("预算用完后不应再查询在线数据源，共查询 %d 次", n)
+	}
+	if _, ok := s.cache.Get("198.51.100.7"); ok {
+		t.Error("预算用完的结果不应缓存")
+	}
+	if n := s.metrics.budgetSkipped.Load(); n != 1 {
+		t.Errorf("ip_geo_budget_skipped_total = %d", n)
+	}
+
+	// 本地数据库不受预算限制
+	if loc := location("1.2.3.4:5000"); loc != "Japan" {
+		t.Errorf("本地数据库应不受预算限制: %q", loc)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+)
+
+// rasterCanvas 池中复用的画布，字体 Face 不能并发使用，因此跟随画布缓存
+type rasterCanvas struct {
+	dc    *gg.Context
+	faces map[faceKey]font.Face
+}
+
+type faceKey struct {
+	size float64
+	bold bool
+}
+
+// maxCanvasPools 最多为多少种尺寸保留画布池，超出的尺寸每次新建画布，
+// 防止通过 ?w=、?h= 构造大量不同尺寸占满内存
+const maxCanvasPools = 32
+
+func newRasterCanvas(width, height int) *rasterCanvas {
+	return &rasterCanvas{
+		dc:    gg.NewContext(width, height),
+		faces: make(map[faceKey]font.Face),
+	}
+}
+
+// canvasPool 返回指定尺寸的画布池，不同尺寸的卡片各用一个池，
+// 池的数量达到上限后返回 nil
+func (s *Server) canvasPool(width, height int) *sync.Pool {
+	key := image.Point{X: width, Y: height}
+	if p, ok := s.canvasPools.Load(key); ok {
+		return p.(*sync.Pool)
+	}
+	if s.poolCount.Load() >= maxCanvasPools {
+		return nil
+	}
+	p, loaded := s.canvasPools.LoadOrStore(key, &sync.Pool{
+		New: func() interface{} {
+			s.metrics.canvasCreated.Add(1)
+			return newRasterCanvas(width, height)
+		},
+	})
+	if !loaded {
+		s.poolCount.Add(1)
+	}
+	return p.(*sync.Pool)
+}
+
+// logoAt 返回边长为 size 像素的 logo，从原图缩放并缓存
+func (s *Server) logoAt(size int) image.Image {
+	if s.logoImage == nil || size <= 0 || size == s.logoImage.Bounds().Dx() {
+		return s.logoImage
+	}
+	if img, ok := s.logoSizes.Load(size); ok {
+		return img.(image.Image)
+	}
+
+	src := s.logoSource
+	if src == nil {
+		src = s.logoImage
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	img, _ := s.logoSizes.LoadOrStore(size, dst)
+	return img.(image.Image)
+}
+
+// face 返回指定字号的字体，字体未加载时返回 nil
+func (s *Server) face(cv *rasterCanvas, size float64, bold bool) font.Face {
+	key := faceKey{size: size, bold: bold}
+	if f, ok := cv.faces[key]; ok {
+		return f
+	}
+	if s.fonts == nil {
+		return nil
+	}
+
+	fonts := s.fonts.regular
+	if bold {
+		fonts = s.fonts.bold
+	}
+	f, err := newFallbackFace(fonts, size)
+	if err != nil {
+		log.Printf("创建字体失败: %v", err)
+		return nil
+	}
+	cv.faces[key] = f
+	return f
+}
+
+// generateImage 按 scale 倍像素密度渲染卡片并编码为 format 格式的位图
+func (s *Server) generateImage(d cardData, theme *Theme, format string, scale, quality int) []byte {
+	l := buildCardLayout(d).scaled(float64(scale))
+	w, h := int(math.Ceil(l.Width)), int(math.Ceil(l.Height))
+
+	var cv *rasterCanvas
+	if pool := s.canvasPool(w, h); pool != nil {
+		cv = pool.Get().(*rasterCanvas)
+		defer pool.Put(cv)
+	} else {
+		s.metrics.canvasCreated.Add(1)
+		cv = newRasterCanvas(w, h)
+	}
+	s.metrics.canvasInUse.Add(1)
+	defer s.metrics.canvasInUse.Add(-1)
+
+	s.renderRaster(cv, l, theme)
+
+	var buf bytes.Buffer
+	if err := s.encodeImage(&buf, cv.dc.Image(), format, quality); err != nil {
+		log.Printf("%s 编码失败: %v", strings.ToUpper(format), err)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// renderRaster 按布局在画布上绘制，与 renderSVG 的输出保持一致
+func (s *Server) renderRaster(cv *rasterCanvas, l *cardLayout, theme *Theme) {
+	dc := cv.dc
+	// 背景和 logo 直接复制预先绘制的图层，图层缓存已满时逐个绘制
+	layer := s.staticLayer(l, theme)
+	if dst, ok := dc.Image().(*image.RGBA); ok && layer != nil && len(dst.Pix) == len(layer.Pix) {
+		copy(dst.Pix, layer.Pix)
+	} else {
+		layer = nil
+		// Clear 使用当前颜色填充，池中的 context 保留着上次绘制的颜色，需先重置为透明
+		dc.SetColor(color.Transparent)
+		dc.Clear()
+	}
+
+	for _, e := range l.Elements {
+		if isStaticElement(e) {
+			if layer == nil {
+				s.drawStatic(dc, l, theme, e)
+			}
+			continue
+		}
+		switch e.Kind {
+		case elementText:
+			face := s.face(cv, e.Size, e.Bold)
+			if face == nil {
+				continue
+			}
+			dc.SetFontFace(face)
+			dc.SetColor(elementColor(theme, e))
+			ax := 0.0
+			if e.Anchor == anchorEnd {
+				ax = 1
+			}
+			// 超出最大宽度时以起点为中心横向压缩，与 SVG 的 textLength 对应
+			if w, _ := dc.MeasureString(e.Text); e.MaxWidth > 0 && w > e.MaxWidth {
+				dc.Push()
+				dc.ScaleAbout(e.MaxWidth/w, 1, e.X, e.Y)
+				dc.DrawStringAnchored(e.Text, e.X, e.Y, ax, 0)
+				dc.Pop()
+				continue
+			}
+			dc.DrawStringAnchored(e.Text, e.X, e.Y, ax, 0)
+		case elementCircle:
+			dc.SetColor(elementColor(theme, e))
+			dc.DrawCircle(e.X, e.Y, e.R)
+			dc.Fill()
+		case elementIcon:
+			drawIcon(dc, e, elementColor(theme, e))
+		}
+	}
+}
+
+// drawStatic 绘制背景或 logo
+func (s *Server) drawStatic(dc *gg.Context, l *cardLayout, theme *Theme, e cardElement) {
+	switch e.Kind {
+	case elementBackground:
+		borderWidth, radius := theme.BorderWidth*l.Scale, theme.Radius*l.Scale
+		inset := borderWidth / 2
+		w, h := l.Width-2*inset, l.Height-2*inset
+
+		gradient := gg.NewLinearGradient(0, 0, l.Width, l.Height)
+		gradient.AddColorStop(0, themeColor(theme.BackgroundStart))
+		gradient.AddColorStop(1, themeColor(theme.BackgroundEnd))
+		dc.SetFillStyle(gradient)
+		dc.DrawRoundedRectangle(inset, inset, w, h, radius)
+		dc.Fill()
+
+		if borderWidth > 0 {
+			dc.SetColor(themeColor(theme.Border))
+			dc.SetLineWidth(borderWidth)
+			dc.DrawRoundedRectangle(inset, inset, w, h, radius)
+			dc.Stroke()
+		}
+	case elementLogo:
+		// 布局缩小或高分辨率输出时按实际像素尺寸重新缩放原图
+		if logo := s.logoAt(int(math.Round(e.W))); logo != nil {
+			dc.DrawImage(logo, int(math.Round(e.X)), int(math.Round(e.Y)))
+		}
+	}
+}
+
+func elementColor(theme *Theme, e cardElement) color.NRGBA {
+	c := themeColor(theme.roleColor(e.Color))
+	if e.Opacity > 0 {
+		c.A = uint8(float64(c.A) * e.Opacity)
+	}
+	return c
+}
+
+// drawIcon 绘制图标，与 writeSVGIcon 的输出一致
+func drawIcon(dc *gg.Context, e cardElement, c color.Color) {
+	k := e.W / iconGrid
+	dc.Push()
+	defer dc.Pop()
+	dc.Translate(e.X, e.Y)
+	dc.Scale(k, k)
+	dc.SetColor(c)
+	// 线宽不随变换矩阵缩放，需要手动换算
+	dc.SetLineWidth(iconStrokeWidth * k)
+	dc.SetLineCap(gg.LineCapRound)
+	dc.SetLineJoin(gg.LineJoinRound)
+	for _, sh := range deviceIcons[e.Icon] {
+		switch sh.Kind {
+		case iconRect:
+			dc.DrawRoundedRectangle(sh.X, sh.Y, sh.W, sh.H, sh.R)
+			dc.Stroke()
+		case iconLine:
+			dc.DrawLine(sh.X, sh.Y, sh.X2, sh.Y2)
+			dc.Stroke()
+		case iconDot:
+			dc.DrawCircle(sh.X, sh.Y, sh.R)
+			dc.Fill()
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+var roleClasses = map[colorRole]string{
+	roleTitle:  "title",
+	roleText:   "text",
+	roleMuted:  "muted",
+	roleAccent: "accent",
+}
+
+// generateSVG 使用预先编码的 logo 和缓存的主题样式生成 SVG
+func (s *Server) generateSVG(d cardData, theme, dark *Theme) string {
+	return renderSVG(buildCardLayout(d), theme, s.themeCSS(theme, dark), s.staticContent().logoBase64)
+}
+
+// renderSVG 按布局输出 SVG，颜色和字体通过主题样式类设置
+func renderSVG(l *cardLayout, theme *Theme, css, logoBase64 string) string {
+	var b strings.Builder
+	b.Grow(len(logoBase64) + 4096)
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="0 0 %g %g">`+"\n",
+		l.Width, l.Height, l.Width, l.Height)
+	fmt.Fprintf(&b, "  <style>%s</style>\n", css)
+
+	for _, e := range l.Elements {
+		switch e.Kind {
+		case elementBackground:
+			// 边框向内收半个线宽，避免被画布裁掉
+			inset := theme.BorderWidth / 2
+			b.WriteString(`  <defs>
+    <linearGradient id="bg" x1="0%" y1="0%" x2="100%" y2="100%">
+      <stop offset="0%" class="bg0" />
+      <stop offset="100%" class="bg1" />
+    </linearGradient>
+  </defs>
+`)
+			fmt.Fprintf(&b, `  <rect x="%g" y="%g" width="%g" height="%g" rx="%g" ry="%g" fill="url(#bg)" class="card"/>`+"\n",
+				inset, inset, l.Width-2*inset, l.Height-2*inset, theme.Radius, theme.Radius)
+		case elementLogo:
+			if logoBase64 == "" {
+				continue
+			}
+			fmt.Fprintf(&b, `  <image x="%g" y="%g" width="%g" height="%g" href="data:image/png;base64,`, e.X, e.Y, e.W, e.H)
+			b.WriteString(logoBase64)
+			b.WriteString("\"/>\n")
+		case elementText:
+			fmt.Fprintf(&b, `  <text x="%g" y="%g" class="%s %s" font-size="%g"%s>%s</text>`+"\n",
+				e.X, e.Y, roleClasses[e.Color], fontClass(e), e.Size, svgTextAttrs(e), html.EscapeString(e.Text))
+		case elementCircle:
+			fmt.Fprintf(&b, `  <circle cx="%g" cy="%g" r="%g" class="%s"%s/>`+"\n",
+				e.X, e.Y, e.R, roleClasses[e.Color], svgOpacity(e))
+		case elementIcon:
+			writeSVGIcon(&b, e)
+		}
+	}
+
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+func fontClass(e cardElement) string {
+	if e.Mono {
+		return "mono"
+	}
+	return "sans"
+}
+
+func svgTextAttrs(e cardElement) string {
+	var attrs string
+	if e.Bold {
+		attrs += ` font-weight="600"`
+	}
+	if e.Anchor == anchorEnd {
+		attrs += ` text-anchor="end"`
+	}
+	// 译文较长时压缩到最大宽度内，避免超出卡片
+	if e.MaxWidth > 0 && estimateTextWidth(e.Text, e.Size, e.Bold) > e.MaxWidth {
+		attrs += fmt.Sprintf(` textLength="%g" lengthAdjust="spacingAndGlyphs"`, e.MaxWidth)
+	}
+	return attrs + svgOpacity(e)
+}
+
+func svgOpacity(e cardElement) string {
+	if e.Opacity == 0 {
+		return ""
+	}
+	return fmt.Sprintf(` opacity="%g"`, e.Opacity)
+}
+
+// writeSVGIcon 输出图标，颜色通过 currentColor 继承角色样式类
+func writeSVGIcon(b *strings.Builder, e cardElement) {
+	fmt.Fprintf(b, `  <g transform="translate(%g %g) scale(%g)" class="icon %s">`, e.X, e.Y, e.W/iconGrid, roleClasses[e.Color])
+	for _, sh := range deviceIcons[e.Icon] {
+		switch sh.Kind {
+		case iconRect:
+			fmt.Fprintf(b, `<rect x="%g" y="%g" width="%g" height="%g" rx="%g"/>`, sh.X, sh.Y, sh.W, sh.H, sh.R)
+		case iconLine:
+			fmt.Fprintf(b, `<line x1="%g" y1="%g" x2="%g" y2="%g"/>`, sh.X, sh.Y, sh.X2, sh.Y2)
+		case iconDot:
+			fmt.Fprintf(b, `<circle cx="%g" cy="%g" r="%g" class="dot"/>`, sh.X, sh.Y, sh.R)
+		}
+	}
+	b.WriteString("</g>\n")
+}
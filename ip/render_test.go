@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func testServer(tb testing.TB) (*Server, cardData) {
+	tb.Helper()
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	s := NewServer(assets)
+	s.LoadLogo("")
+	s.PrepareStatic()
+	d := cardData{
+		IP:          "1.1.1.1",
+		UA:          "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/129.0.0.0 Safari/537.36",
+		Loc:         "Queensland Brisbane",
+		Now:         "2026-10-16 20:36:35 AEST (UTC+10)",
+		Geo:         &GeoInfo{Country: "AU"},
+		Msg:         catalogs["zh"],
+		cardOptions: parseCardOptions(url.Values{}),
+	}
+	return s, d
+}
+
+// disableStaticLayers 占满图层缓存，之后按原方式逐个元素绘制背景和 logo
+func disableStaticLayers(s *Server) {
+	s.resetStatic()
+	s.staticContent().layerCount.Store(maxStaticLayers)
+}
+
+// 使用静态图层与逐个元素绘制的结果应完全相同
+func TestGenerateImageStaticLayer(t *testing.T) {
+	s, d := testServer(t)
+	theme, _ := s.resolveTheme("dark")
+	for _, scale := range []int{1, 2} {
+		withLayer := decodePNG(t, s.generateImage(d, theme, formatPNG, scale, 90))
+		disableStaticLayers(s)
+		without := decodePNG(t, s.generateImage(d, theme, formatPNG, scale, 90))
+		s.resetStatic()
+
+		if withLayer.Bounds() != without.Bounds() {
+			t.Fatalf("@%dx 尺寸不同: %v, %v", scale, withLayer.Bounds(), without.Bounds())
+		}
+		b := withLayer.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if withLayer.At(x, y) != without.At(x, y) {
+					t.Fatalf("@%dx 像素 (%d,%d) 不同: %v, %v", scale, x, y, withLayer.At(x, y), without.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+func decodePNG(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func BenchmarkGenerateSVG(b *testing.B) {
+	s, d := testServer(b)
+	theme, dark := s.resolveTheme("dark")
+	b.ReportAllocs()
+	for b.Loop() {
+		s.generateSVG(d, theme, dark)
+	}
+}
+
+// BenchmarkGenerateImage 对比使用静态图层和逐个元素绘制（NoStaticLayer）的耗时
+func BenchmarkGenerateImage(b *testing.B) {
+	cases := []struct {
+		name   string
+		format string
+		scale  int
+	}{
+		{"PNG", formatPNG, 1},
+		{"PNG@2x", formatPNG, 2},
+		{"WebP", formatWebP, 1},
+	}
+	for _, static := range []bool{true, false} {
+		for _, tc := range cases {
+			name := tc.name
+			if !static {
+				name += "/NoStaticLayer"
+			}
+			b.Run(name, func(b *testing.B) {
+				s, d := testServer(b)
+				if !static {
+					disableStaticLayers(s)
+				}
+				theme, _ := s.resolveTheme("dark")
+				b.ReportAllocs()
+				for b.Loop() {
+					if s.generateImage(d, theme, tc.format, tc.scale, 90) == nil {
+						b.Fatal("生成图片失败")
+					}
+				}
+			})
+		}
+	}
+}
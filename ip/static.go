@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"log"
+	"math"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fogleman/gg"
+)
+
+// 卡片中与访客无关的部分（logo 的 base64、主题样式、背景和 logo 图层）
+// 在加载 logo、主题后生成一次，请求只绘制文字等动态内容
+
+// maxStaticLayers 最多缓存多少个背景图层，与 maxCanvasPools 一样防止
+// 通过大量不同尺寸占满内存，超出后按原方式逐个元素绘制
+const maxStaticLayers = 64
+
+// staticCache 预先生成的静态内容，logo 或主题变化时整体替换
+type staticCache struct {
+	version    int64 // 生成时间，用于 ETag，logo 或主题变化后旧的 ETag 失效
+	logoBase64 string
+	css        sync.Map // [2]*Theme → string
+	layers     sync.Map // layerKey → *image.RGBA
+	layerCount atomic.Int32
+}
+
+// layerKey 背景图层由主题、画布尺寸、缩放倍数和 logo 位置决定
+type layerKey struct {
+	theme  *Theme
+	width  int
+	height int
+	scale  float64
+	logo   image.Rectangle
+}
+
+// resetStatic 丢弃已生成的静态内容并重新编码 logo，加载 logo 或主题后调用
+func (s *Server) resetStatic() {
+	c := &staticCache{version: time.Now().UnixNano()}
+	if s.logoImage != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, s.logoImage); err == nil {
+			c.logoBase64 = base64.StdEncoding.EncodeToString(buf.Bytes())
+		}
+	}
+	s.logoSizes.Clear()
+	s.static.Store(c)
+}
+
+// staticContent 返回当前的静态内容，未初始化时先生成
+func (s *Server) staticContent() *staticCache {
+	if c := s.static.Load(); c != nil {
+		return c
+	}
+	s.resetStatic()
+	return s.static.Load()
+}
+
+// PrepareStatic 为所有主题预先生成默认卡片的背景图层和样式，
+// 避免启动后的第一批请求集中生成
+func (s *Server) PrepareStatic() {
+	s.resetStatic()
+	d := cardData{Msg: catalogs[s.defaultLang], cardOptions: parseCardOptions(url.Values{})}
+	l := buildCardLayout(d)
+	for _, theme := range s.themes {
+		s.staticLayer(l, theme)
+		s.themeCSS(theme, nil)
+	}
+	s.themeCSS(s.resolveTheme(themeAuto))
+	log.Printf("已生成 %d 个主题的静态图层", len(s.themes))
+}
+
+// themeCSS 返回缓存的主题样式
+func (s *Server) themeCSS(theme, dark *Theme) string {
+	c := s.staticContent()
+	key := [2]*Theme{theme, dark}
+	if css, ok := c.css.Load(key); ok {
+		return css.(string)
+	}
+	css, _ := c.css.LoadOrStore(key, svgThemeCSS(theme, dark))
+	return css.(string)
+}
+
+// staticLayer 返回已绘制背景、边框和 logo 的图层，缓存已满时返回 nil
+func (s *Server) staticLayer(l *cardLayout, theme *Theme) *image.RGBA {
+	c := s.staticContent()
+	key := layerKey{theme: theme, width: int(math.Ceil(l.Width)), height: int(math.Ceil(l.Height)), scale: l.Scale}
+	for _, e := range l.Elements {
+		if e.Kind == elementLogo {
+			key.logo = image.Rect(int(math.Round(e.X)), int(math.Round(e.Y)), int(math.Round(e.X+e.W)), int(math.Round(e.Y+e.H)))
+		}
+	}
+	if layer, ok := c.layers.Load(key); ok {
+		return layer.(*image.RGBA)
+	}
+	if c.layerCount.Load() >= maxStaticLayers {
+		return nil
+	}
+
+	dc := gg.NewContext(key.width, key.height)
+	for _, e := range l.Elements {
+		if isStaticElement(e) {
+			s.drawStatic(dc, l, theme, e)
+		}
+	}
+	layer, loaded := c.layers.LoadOrStore(key, dc.Image().(*image.RGBA))
+	if !loaded {
+		c.layerCount.Add(1)
+	}
+	return layer.(*image.RGBA)
+}
+
+// isStaticElement 背景和 logo 不随访客变化，可以预先绘制
+func isStaticElement(e cardElement) bool {
+	return e.Kind == elementBackground || e.Kind == elementLogo
+}
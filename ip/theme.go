@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// themeAuto 跟随系统深浅色，SVG 通过 prefers-color-scheme 切换 light/dark 两个主题
+const themeAuto = "auto"
+
+// Theme 卡片主题，颜色使用 #rgb、#rrggbb 或 #rrggbbaa 格式
+type Theme struct {
+	Name            string  `json:"name" yaml:"name"`
+	Extends         string  `json:"extends,omitempty" yaml:"extends,omitempty"`
+	BackgroundStart string  `json:"background_start" yaml:"background_start"`
+	BackgroundEnd   string  `json:"background_end" yaml:"background_end"`
+	Border          string  `json:"border" yaml:"border"`
+	BorderWidth     float64 `json:"border_width" yaml:"border_width"`
+	Title           string  `json:"title" yaml:"title"`
+	Text            string  `json:"text" yaml:"text"`
+	Muted           string  `json:"muted" yaml:"muted"`
+	Accent          string  `json:"accent" yaml:"accent"`
+	Radius          float64 `json:"radius" yaml:"radius"`
+	Font            string  `json:"font" yaml:"font"`
+	MonoFont        string  `json:"mono_font" yaml:"mono_font"`
+}
+
+var builtinThemes = []*Theme{
+	{
+		Name:            "dark",
+		BackgroundStart: "#1e293b",
+		BackgroundEnd:   "#0f172a",
+		Border:          "#ffffff1a",
+		BorderWidth:     1,
+		Title:           "#ffffff",
+		Text:            "#cbd5e1",
+		Muted:           "#94a3b8",
+		Accent:          "#10b981",
+		Radius:          16,
+		Font:            "system-ui, -apple-system, sans-serif",
+		MonoFont:        "system-ui, -apple-system, monospace",
+	},
+	{
+		Name:            "light",
+		BackgroundStart: "#ffffff",
+		BackgroundEnd:   "#f1f5f9",
+		Border:          "#0f172a1f",
+		BorderWidth:     1,
+		Title:           "#0f172a",
+		Text:            "#334155",
+		Muted:           "#64748b",
+		Accent:          "#059669",
+		Radius:          16,
+		Font:            "system-ui, -apple-system, sans-serif",
+		MonoFont:        "system-ui, -apple-system, monospace",
+	},
+	{
+		Name:            "solarized",
+		BackgroundStart: "#073642",
+		BackgroundEnd:   "#002b36",
+		Border:          "#93a1a133",
+		BorderWidth:     1,
+		Title:           "#fdf6e3",
+		Text:            "#93a1a1",
+		Muted:           "#839496",
+		Accent:          "#859900",
+		Radius:          16,
+		Font:            "system-ui, -apple-system, sans-serif",
+		MonoFont:        "system-ui, -apple-system, monospace",
+	},
+	{
+		Name:            "high-contrast",
+		BackgroundStart: "#000000",
+		BackgroundEnd:   "#000000",
+		Border:          "#ffffff",
+		BorderWidth:     2,
+		Title:           "#ffffff",
+		Text:            "#ffffff",
+		Muted:           "#ffd700",
+		Accent:          "#00ff00",
+		Radius:          8,
+		Font:            "system-ui, -apple-system, sans-serif",
+		MonoFont:        "system-ui, -apple-system, monospace",
+	},
+}
+
+func defaultThemes() map[string]*Theme {
+	themes := make(map[string]*Theme, len(builtinThemes))
+	for _, t := range builtinThemes {
+		themes[t.Name] = t
+	}
+	return themes
+}
+
+// validate 检查颜色和字体，避免非法值写入 SVG 样式
+func (t *Theme) validate() error {
+	colors := map[string]string{
+		"background_start": t.BackgroundStart,
+		"background_end":   t.BackgroundEnd,
+		"border":           t.Border,
+		"title":            t.Title,
+		"text":             t.Text,
+		"muted":            t.Muted,
+		"accent":           t.Accent,
+	}
+	for field, value := range colors {
+		if _, err := parseHexColor(value); err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+	}
+	for _, f := range []string{t.Font, t.MonoFont} {
+		if strings.ContainsAny(f, "<>{};\\&") {
+			return fmt.Errorf("字体名称包含非法字符: %s", f)
+		}
+	}
+	if t.Radius < 0 || t.BorderWidth < 0 {
+		return fmt.Errorf("圆角和边框宽度不能为负数")
+	}
+	return nil
+}
+
+// LoadThemes 从 JSON/YAML 文件或目录加载自定义主题，同名主题覆盖内置主题。
+// 未设置的字段继承 extends 指定的主题，默认继承 dark
+func (s *Server) LoadThemes(paths []string) error {
+	var files []string
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		for _, pattern := range []string{"*.json", "*.yaml", "*.yml"} {
+			matches, _ := filepath.Glob(filepath.Join(p, pattern))
+			files = append(files, matches...)
+		}
+	}
+
+	for _, file := range files {
+		theme, err := s.loadThemeFile(file)
+		if err != nil {
+			return fmt.Errorf("加载主题 %s 失败: %w", file, err)
+		}
+		s.themes[theme.Name] = theme
+		log.Printf("已加载主题: %s", theme.Name)
+	}
+	return nil
+}
+
+func (s *Server) loadThemeFile(file string) (*Theme, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	unmarshal := yaml.Unmarshal
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		unmarshal = json.Unmarshal
+	}
+
+	// 先读出 extends，再在父主题的副本上解码，文件中没有的字段保持父主题的值
+	var header struct {
+		Extends string `json:"extends" yaml:"extends"`
+	}
+	if err := unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	if header.Extends == "" {
+		header.Extends = "dark"
+	}
+	base, ok := s.themes[header.Extends]
+	if !ok {
+		return nil, fmt.Errorf("未知的父主题: %s", header.Extends)
+	}
+
+	theme := *base
+	theme.Name = ""
+	if err := unmarshal(data, &theme); err != nil {
+		return nil, err
+	}
+	if theme.Name == "" {
+		theme.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	if err := theme.validate(); err != nil {
+		return nil, err
+	}
+	return &theme, nil
+}
+
+// SetDefaultTheme 设置未指定 ?theme= 时使用的主题
+func (s *Server) SetDefaultTheme(name string) error {
+	if name != themeAuto {
+		if _, ok := s.themes[name]; !ok {
+			return fmt.Errorf("未知的主题: %s", name)
+		}
+	}
+	s.defaultTheme = name
+	return nil
+}
+
+// resolveTheme 返回请求使用的主题；auto 模式下 dark 不为 nil，
+// SVG 在深色模式下切换为 dark，PNG 等无法自适应的格式使用 theme
+func (s *Server) resolveTheme(name string) (theme, dark *Theme) {
+	if _, ok := s.themes[name]; !ok && name != themeAuto {
+		name = s.defaultTheme
+	}
+	if name == themeAuto {
+		return s.themes["light"], s.themes["dark"]
+	}
+	return s.themes[name], nil
+}
+
+// parseHexColor 解析 #rgb、#rrggbb、#rrggbbaa 格式的颜色
+func parseHexColor(s string) (color.NRGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 || !strings.HasPrefix(strings.TrimSpace(s), "#") {
+		return color.NRGBA{}, fmt.Errorf("无效的颜色: %q", s)
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("无效的颜色: %q", s)
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// themeColor 返回主题颜色，已经过 validate 校验，解析失败时返回透明色
+func themeColor(s string) color.NRGBA {
+	c, _ := parseHexColor(s)
+	return c
+}
+
+// cssColor 将主题颜色转换为 CSS rgba()，兼容不支持 #rrggbbaa 的渲染器
+func cssColor(s string) string {
+	c := themeColor(s)
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("rgba(%d,%d,%d,%.3g)", c.R, c.G, c.B, float64(c.A)/255)
+}
+
+// svgThemeCSS 生成 SVG 中使用的样式，dark 不为 nil 时按 prefers-color-scheme 切换
+func svgThemeCSS(theme, dark *Theme) string {
+	rules := func(t *Theme) string {
+		return fmt.Sprintf(
+			".bg0{stop-color:%s}.bg1{stop-color:%s}.card{stroke:%s;stroke-width:%g}"+
+				".title{fill:%[5]s;color:%[5]s}.text{fill:%[6]s;color:%[6]s}.muted{fill:%[7]s;color:%[7]s}.accent{fill:%[8]s;color:%[8]s}"+
+				".sans{font-family:%[9]s}.mono{font-family:%[10]s}",
+			cssColor(t.BackgroundStart), cssColor(t.BackgroundEnd), cssColor(t.Border), t.BorderWidth,
+			cssColor(t.Title), cssColor(t.Text), cssColor(t.Muted), cssColor(t.Accent),
+			t.Font, t.MonoFont)
+	}
+
+	css := rules(theme)
+	if dark != nil {
+		css += "@media (prefers-color-scheme: dark){" + rules(dark) + "}"
+	}
+	// 图标放在最后，覆盖角色样式类的 fill
+	css += fmt.Sprintf(".icon{fill:none;stroke:currentColor;stroke-width:%g;stroke-linecap:round;stroke-linejoin:round}"+
+		".icon .dot{fill:currentColor;stroke:none}", iconStrokeWidth)
+	return css
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	// 内置时区数据库，精简镜像中没有 /usr/share/zoneinfo 时也能使用
+	_ "time/tzdata"
+)
+
+// 卡片上的时间格式，时区部分由 formatZone 生成
+const cardTimeLayout = "2006-01-02 15:04:05"
+
+// locations 已加载的时区，只缓存加载成功的名称，数量受时区数据库限制
+var locations sync.Map
+
+// loadLocation 按 IANA 名称（如 Asia/Tokyo）加载时区，结果会被缓存
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	if len(name) > 64 {
+		return nil, fmt.Errorf("无效的时区: %s", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区: %s", name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// SetDefaultTimeZone 设置无法从 IP 判断时区时使用的时区，留空使用服务器本地时区
+func (s *Server) SetDefaultTimeZone(name string) error {
+	if name == "" {
+		s.defaultTZ = time.Local
+		return nil
+	}
+	loc, err := loadLocation(name)
+	if err != nil {
+		return err
+	}
+	s.defaultTZ = loc
+	return nil
+}
+
+// resolveTimeZone 按 ?tz= 参数、数据源返回的时区、默认时区的顺序选择时区
+func (s *Server) resolveTimeZone(tz string, info *GeoInfo) *time.Location {
+	if tz != "" {
+		if loc, err := loadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	if info != nil && info.TimeZone != "" {
+		if loc, err := loadLocation(info.TimeZone); err == nil {
+			return loc
+		}
+	}
+	return s.defaultTZ
+}
+
+// formatZone 返回 "JST (UTC+9)" 格式的时区缩写和偏移，
+// 没有缩写的时区（数据库中写作 +03 之类）只显示偏移
+func formatZone(t time.Time) string {
+	name, offset := t.Zone()
+	utc := formatOffset(offset)
+	if name == "" || name == "UTC" || strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+		return utc
+	}
+	return name + " (" + utc + ")"
+}
+
+// formatOffset 将秒数偏移格式化为 UTC+9、UTC+5:30、UTC-3 的形式
+func formatOffset(offset int) string {
+	if offset == 0 {
+		return "UTC"
+	}
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	hours, minutes := offset/3600, offset%3600/60
+	if minutes == 0 {
+		return fmt.Sprintf("UTC%s%d", sign, hours)
+	}
+	return fmt.Sprintf("UTC%s%d:%02d", sign, hours, minutes)
+}
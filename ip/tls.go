@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSOptions HTTPS 配置
+type TLSOptions struct {
+	CertFile     string        // 证书文件（PEM），可包含中间证书
+	KeyFile      string        // 私钥文件（PEM）
+	RedirectAddr string        // HTTP 跳转到 HTTPS 的监听地址，如 :80，留空不监听
+	Reload       time.Duration // 检查证书文件更新的间隔，0 为不自动重新加载
+}
+
+// SetupTLS 加载证书并启用 HTTPS，reload 大于 0 时定期检查证书文件更新，续期后无需重启
+func (s *Server) SetupTLS(opts TLSOptions) error {
+	if opts.CertFile == "" && opts.KeyFile == "" {
+		if opts.RedirectAddr != "" {
+			return errors.New("HTTP 跳转需要同时配置证书和私钥")
+		}
+		return nil
+	}
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return errors.New("证书和私钥需要同时配置")
+	}
+
+	certs := &certReloader{certFile: opts.CertFile, keyFile: opts.KeyFile}
+	if _, err := certs.reload(); err != nil {
+		return err
+	}
+	s.certs = certs
+	s.redirectAddr = opts.RedirectAddr
+	log.Printf("已加载证书: %s，有效期至 %s", opts.CertFile, certs.expiry().Format(time.DateOnly))
+
+	if opts.Reload > 0 {
+		go certs.watch(opts.Reload)
+	}
+	return nil
+}
+
+// tlsConfig 返回 HTTPS 服务的配置，每次握手取当前的证书，并通过 ALPN 启用 HTTP/2
+func (s *Server) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.certs.getCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// certReloader 保存当前使用的证书，证书或私钥文件的修改时间变化时重新加载
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+// reload 在文件修改时间变化时重新加载证书，返回是否发生了重新加载。
+// 续期工具可能先后写入证书和私钥，两者不匹配时保留旧证书，下次检查时重试
+func (c *certReloader) reload() (bool, error) {
+	certStat, err := os.Stat(c.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyStat, err := os.Stat(c.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	unchanged := c.cert != nil && certStat.ModTime().Equal(c.certTime) && keyStat.ModTime().Equal(c.keyTime)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("加载证书失败: %w", err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.certTime = certStat.ModTime()
+	c.keyTime = keyStat.ModTime()
+	c.mu.Unlock()
+	return true, nil
+}
+
+// watch 按固定间隔检查证书文件是否更新
+func (c *certReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		reloaded, err := c.reload()
+		if err != nil {
+			log.Printf("重新加载证书失败: %v，继续使用当前证书", err)
+			continue
+		}
+		if reloaded {
+			log.Printf("已重新加载证书: %s，有效期至 %s", c.certFile, c.expiry().Format(time.DateOnly))
+		}
+	}
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// expiry 返回当前证书的到期时间
+func (c *certReloader) expiry() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	leaf := c.cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(c.cert.Certificate[0]); err != nil {
+			return time.Time{}
+		}
+	}
+	return leaf.NotAfter
+}
+
+// redirectHandler 将 HTTP 请求永久跳转到 HTTPS 服务端口上的同一路径
+func redirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		// 不带端口的 IPv6 地址（如 [::1]）SplitHostPort 会失败，需要自己去掉方括号
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if host == "" {
+			http.Error(w, "缺少 Host 头", http.StatusBadRequest)
+			return
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		// 非 GET/HEAD 请求使用 308，保留请求方法和请求体
+		code := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			code = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	})
+}
+
+// serveRedirect 在 addr 上监听 HTTP，全部跳转到 HTTPS，返回的服务随主服务一起关闭
+func (s *Server) serveRedirect(addr, httpsPort string) *http.Server {
+	srv := s.newHTTPServer(addr, redirectHandler(httpsPort))
+	log.Printf("HTTP 跳转: %s → HTTPS 端口 %s", addr, httpsPort)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP 跳转服务启动失败: %v", err)
+		}
+	}()
+	return srv
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		host   string
+		port   string
+		code   int
+		want   string
+	}{
+		{"域名", http.MethodGet, "example.com", "8443", http.StatusMovedPermanently, "https://example.com:8443/x?a=1"},
+		{"域名带端口", http.MethodGet, "example.com:80", "8443", http.StatusMovedPermanently, "https://example.com:8443/x?a=1"},
+		{"默认端口", http.MethodGet, "example.com:80", "443", http.StatusMovedPermanently, "https://example.com/x?a=1"},
+		{"IPv6 不带端口", http.MethodGet, "[::1]", "8443", http.StatusMovedPermanently, "https://[::1]:8443/x?a=1"},
+		{"IPv6 带端口", http.MethodGet, "[::1]:80", "8443", http.StatusMovedPermanently, "https://[::1]:8443/x?a=1"},
+		{"IPv6 默认端口", http.MethodHead, "[2001:db8::1]", "443", http.StatusMovedPermanently, "https://[2001:db8::1]/x?a=1"},
+		{"POST 保留方法", http.MethodPost, "example.com", "443", http.StatusPermanentRedirect, "https://example.com/x?a=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/x?a=1", nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			redirectHandler(tt.port).ServeHTTP(w, req)
+			if w.Code != tt.code || w.Header().Get("Location") != tt.want {
+				t.Errorf("%s %s = %d %s，期望 %d %s", tt.method, tt.host, w.Code, w.Header().Get("Location"), tt.code, tt.want)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/x", nil)
+	req.Host = "[]"
+	w := httptest.NewRecorder()
+	redirectHandler("443").ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("空 Host 应返回 400: %d", w.Code)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import "strings"
+
+// 设备类型
+const (
+	deviceDesktop = "desktop"
+	deviceMobile  = "mobile"
+	deviceTablet  = "tablet"
+	deviceBot     = "bot"
+)
+
+// ClientInfo 从 User-Agent 解析出的浏览器、系统和设备信息
+type ClientInfo struct {
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	Device         string `json:"device,omitempty"` // desktop、mobile、tablet、bot，无法判断时为空
+	Model          string `json:"model,omitempty"`
+	Bot            string `json:"bot,omitempty"` // 爬虫名称
+}
+
+// uaToken User-Agent 中的产品标记，如 Chrome/129.0.0.0
+type uaToken struct {
+	token string
+	name  string
+}
+
+// knownBots 常见爬虫，按顺序匹配
+var knownBots = []uaToken{
+	{"Googlebot", "Googlebot"},
+	{"Google-InspectionTool", "Google Inspection Tool"},
+	{"AdsBot-Google", "AdsBot-Google"},
+	{"bingbot", "Bingbot"},
+	{"YandexBot", "YandexBot"},
+	{"Baiduspider", "Baiduspider"},
+	{"Sogou web spider", "Sogou Spider"},
+	{"360Spider", "360Spider"},
+	{"Bytespider", "Bytespider"},
+	{"PetalBot", "PetalBot"},
+	{"DuckDuckBot", "DuckDuckBot"},
+	{"Applebot", "Applebot"},
+	{"facebookexternalhit", "Facebook"},
+	{"Twitterbot", "Twitterbot"},
+	{"Slackbot", "Slackbot"},
+	{"Discordbot", "Discordbot"},
+	{"TelegramBot", "TelegramBot"},
+	{"LinkedInBot", "LinkedInBot"},
+	{"GPTBot", "GPTBot"},
+	{"ClaudeBot", "ClaudeBot"},
+	{"AhrefsBot", "AhrefsBot"},
+	{"SemrushBot", "SemrushBot"},
+	{"MJ12bot", "MJ12bot"},
+	{"UptimeRobot", "UptimeRobot"},
+}
+
+// knownBrowsers 浏览器标记，基于 Chromium 的浏览器排在 Chrome 前面
+var knownBrowsers = []uaToken{
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"Edg/", "Edge"},
+	{"Edge/", "Edge"},
+	{"OPR/", "Opera"},
+	{"OPiOS/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"UCBrowser/", "UC Browser"},
+	{"Vivaldi/", "Vivaldi"},
+	{"MicroMessenger/", "WeChat"},
+	{"QQBrowser/", "QQ Browser"},
+	{"MiuiBrowser/", "MIUI Browser"},
+	{"HuaweiBrowser/", "Huawei Browser"},
+	{"DuckDuckGo/", "DuckDuckGo"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"HeadlessChrome/", "Headless Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Chrome/", "Chrome"},
+}
+
+// knownTools 命令行工具和 HTTP 库，不属于任何设备类型
+var knownTools = []uaToken{
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+	{"HTTPie/", "HTTPie"},
+	{"xh/", "xh"},
+	{"python-requests/", "Python Requests"},
+	{"Python-urllib/", "Python urllib"},
+	{"Go-http-client/", "Go HTTP Client"},
+	{"okhttp/", "OkHttp"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+// windowsVersions Windows NT 内核版本与系统版本的对应关系。
+// Windows 11 的 UA 同样是 NT 10.0，只能通过 Client Hints 区分
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+	"6.0":  "Vista",
+	"5.2":  "XP",
+	"5.1":  "XP",
+}
+
+// parseUserAgent 解析 User-Agent，无法识别的部分留空
+func parseUserAgent(ua string) ClientInfo {
+	var info ClientInfo
+	if ua == "" {
+		return info
+	}
+
+	if bot := detectBot(ua); bot != "" {
+		info.Bot = bot
+		info.Device = deviceBot
+		return info
+	}
+	for _, t := range knownTools {
+		if strings.HasPrefix(ua, t.token) {
+			info.Browser = t.name
+			info.BrowserVersion = versionAfter(ua, t.token)
+			return info
+		}
+	}
+
+	info.Browser, info.BrowserVersion = detectBrowser(ua)
+	info.OS, info.OSVersion = detectOS(ua)
+	info.Device = detectDevice(ua, info.OS)
+	if info.OS == "Android" {
+		info.Model = androidModel(ua)
+	}
+	return info
+}
+
+func detectBot(ua string) string {
+	for _, b := range knownBots {
+		if strings.Contains(ua, b.token) {
+			return b.name
+		}
+	}
+	// 未收录的爬虫通常以 XxxBot/1.0 或 (compatible; XxxBot; ...) 的形式自称 bot、spider
+	// 或 crawler。只匹配以这些词结尾、后跟版本号或分号的完整标记，
+	// 避免把 Cubot 手机的机型、URL 中的 /bot.html 等当作爬虫
+	lower := strings.ToLower(ua)
+	for _, word := range []string{"bot", "spider", "crawler"} {
+		for from := 0; ; {
+			i := strings.Index(lower[from:], word)
+			if i < 0 {
+				break
+			}
+			i += from
+			end := i + len(word)
+			from = end
+			if end == len(ua) || (ua[end] != '/' && ua[end] != ';') {
+				continue
+			}
+			start := strings.LastIndexAny(ua[:i], " ;(+,") + 1
+			if strings.Contains(ua[start:i], "/") {
+				// URL 路径，不是产品名
+				continue
+			}
+			return ua[start:end]
+		}
+	}
+	return ""
+}
+
+func detectBrowser(ua string) (string, string) {
+	for _, b := range knownBrowsers {
+		if strings.Contains(ua, b.token) {
+			return b.name, versionAfter(ua, b.token)
+		}
+	}
+	switch {
+	case strings.Contains(ua, "Safari/") && strings.Contains(ua, "Version/"):
+		return "Safari", versionAfter(ua, "Version/")
+	case strings.Contains(ua, "MSIE "):
+		return "Internet Explorer", versionAfter(ua, "MSIE ")
+	case strings.Contains(ua, "Trident/"):
+		return "Internet Explorer", versionAfter(ua, "rv:")
+	case strings.Contains(ua, "AppleWebKit/") && (strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad")):
+		// 应用内置的 WebView
+		return "WebView", ""
+	}
+	return "", ""
+}
+
+func detectOS(ua string) (string, string) {
+	switch {
+	case strings.Contains(ua, "Windows Phone"):
+		return "Windows Phone", versionAfter(ua, "Windows Phone ")
+	case strings.Contains(ua, "Windows NT"):
+		return "Windows", windowsVersions[versionAfter(ua, "Windows NT ")]
+	case strings.Contains(ua, "iPad"):
+		return "iPadOS", versionAfter(ua, " OS ")
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		return "iOS", versionAfter(ua, " OS ")
+	case strings.Contains(ua, "Mac OS X"):
+		return "macOS", versionAfter(ua, "Mac OS X ")
+	case strings.Contains(ua, "HarmonyOS"):
+		return "HarmonyOS", versionAfter(ua, "HarmonyOS ")
+	case strings.Contains(ua, "Android"):
+		return "Android", versionAfter(ua, "Android ")
+	case strings.Contains(ua, "CrOS"):
+		return "ChromeOS", ""
+	case strings.Contains(ua, "Ubuntu"):
+		return "Ubuntu", ""
+	case strings.Contains(ua, "Fedora"):
+		return "Fedora", ""
+	case strings.Contains(ua, "Linux"):
+		return "Linux", ""
+	case strings.Contains(ua, "FreeBSD"):
+		return "FreeBSD", ""
+	}
+	return "", ""
+}
+
+func detectDevice(ua, os string) string {
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet") ||
+		strings.Contains(ua, "Kindle") || strings.Contains(ua, "Silk/"):
+		return deviceTablet
+	case strings.Contains(ua, "Mobile") || strings.Contains(ua, "iPhone") ||
+		strings.Contains(ua, "iPod") || os == "Windows Phone":
+		return deviceMobile
+	case os == "Android" || os == "HarmonyOS":
+		// Android 平板的 UA 不带 Mobile
+		return deviceTablet
+	case os != "":
+		return deviceDesktop
+	}
+	return ""
+}
+
+// androidModel 取 "Android 14; Pixel 8 Build/..." 中的机型，
+// 冻结后的 UA 中机型固定为 K，视为未知；wv 表示 WebView
+func androidModel(ua string) string {
+	i := strings.Index(ua, "Android")
+	if i < 0 {
+		return ""
+	}
+	rest := ua[i:]
+	end := strings.IndexByte(rest, ')')
+	if end < 0 {
+		return ""
+	}
+	for _, part := range strings.Split(rest[:end], ";")[1:] {
+		model, _, _ := strings.Cut(strings.TrimSpace(part), " Build/")
+		if model == "" || model == "K" || model == "wv" {
+			continue
+		}
+		return model
+	}
+	return ""
+}
+
+// versionAfter 返回 token 后面的版本号，iOS 中的 17_4 转换为 17.4
+func versionAfter(ua, token string) string {
+	i := strings.Index(ua, token)
+	if i < 0 {
+		return ""
+	}
+	rest := ua[i+len(token):]
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.' && r != '_'
+	})
+	if end >= 0 {
+		rest = rest[:end]
+	}
+	return strings.Trim(strings.ReplaceAll(rest, "_", "."), ".")
+}
+
+// shortVersion 卡片上显示的简短版本号，如 129.0.0.0 → 129、17.4.1 → 17.4
+func shortVersion(v string) string {
+	parts := strings.SplitN(v, ".", 3)
+	if len(parts) >= 2 && parts[1] != "0" {
+		return parts[0] + "." + parts[1]
+	}
+	return parts[0]
+}
+
+// Summary 返回 "Chrome 129 · Windows 11 · 桌面" 格式的描述
+func (c ClientInfo) Summary(m *messages) string {
+	var parts []string
+	add := func(name, version string) {
+		if name == "" {
+			return
+		}
+		if version != "" {
+			name += " " + shortVersion(version)
+		}
+		parts = append(parts, name)
+	}
+
+	if c.Bot != "" {
+		add(c.Bot, "")
+	} else {
+		add(c.Browser, c.BrowserVersion)
+		add(c.OS, c.OSVersion)
+		add(c.Model, "")
+	}
+	if device := m.deviceName(c.Device); device != "" {
+		parts = append(parts, device)
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name    string
+		ua      string
+		want    ClientInfo
+		summary string
+	}{
+		{"Chrome Windows",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+			ClientInfo{Browser: "Chrome", BrowserVersion: "129.0.0.0", OS: "Windows", OSVersion: "10", Device: deviceDesktop},
+			"Chrome 129 · Windows 10 · Desktop"},
+		{"Safari iOS",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+			ClientInfo{Browser: "Safari", BrowserVersion: "17.4", OS: "iOS", OSVersion: "17.4", Device: deviceMobile},
+			"Safari 17.4 · iOS 17.4 · Mobile"},
+		{"Firefox Linux",
+			"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+			ClientInfo{Browser: "Firefox", BrowserVersion: "131.0", OS: "Ubuntu", Device: deviceDesktop},
+			"Firefox 131 · Ubuntu · Desktop"},
+		{"Edge macOS",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.2792.79",
+			ClientInfo{Browser: "Edge", BrowserVersion: "129.0.2792.79", OS: "macOS", OSVersion: "10.15.7", Device: deviceDesktop},
+			"Edge 129 · macOS 10.15 · Desktop"},
+		{"Android 平板",
+			"Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+			ClientInfo{Browser: "Chrome", BrowserVersion: "129.0.0.0", OS: "Android", OSVersion: "14", Device: deviceTablet, Model: "SM-X710"},
+			"Chrome 129 · Android 14 · SM-X710 · Tablet"},
+		{"Android 冻结 UA",
+			"Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Mobile Safari/537.36",
+			ClientInfo{Browser: "Chrome", BrowserVersion: "129.0.0.0", OS: "Android", OSVersion: "10", Device: deviceMobile},
+			"Chrome 129 · Android 10 · Mobile"},
+		{"Cubot 手机不是爬虫",
+			"Mozilla/5.0 (Linux; Android 11; CUBOT_X30 Build/RP1A.200720.011) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.6668.100 Mobile Safari/537.36",
+			ClientInfo{Browser: "Chrome", BrowserVersion: "129.0.6668.100", OS: "Android", OSVersion: "11", Device: deviceMobile, Model: "CUBOT_X30"},
+			"Chrome 129 · Android 11 · CUBOT_X30 · Mobile"},
+		{"Cubot 机型在末尾",
+			"Mozilla/5.0 (Linux; Android 12; Cubot P60) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Mobile Safari/537.36",
+			ClientInfo{Browser: "Chrome", BrowserVersion: "129.0.0.0", OS: "Android", OSVersion: "12", Device: deviceMobile, Model: "Cubot P60"},
+			"Chrome 129 · Android 12 · Cubot P60 · Mobile"},
+		{"Googlebot",
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			ClientInfo{Device: deviceBot, Bot: "Googlebot"},
+			"Googlebot · Bot"},
+		{"未收录的爬虫",
+			"Mozilla/5.0 (compatible; SeznamBot/4.0; +https://o-seznam.cz/napoveda/vyhledavani/en/seznambot-crawler/)",
+			ClientInfo{Device: deviceBot, Bot: "SeznamBot"},
+			"SeznamBot · Bot"},
+		{"不带版本号的爬虫",
+			"Mozilla/5.0 (compatible; ExampleSpider; +https://example.com/spider.html)",
+			ClientInfo{Device: deviceBot, Bot: "ExampleSpider"},
+			"ExampleSpider · Bot"},
+		{"URL 中的 bot 不算爬虫",
+			"ExampleApp/2.0 (+https://example.com/bot/help)",
+			ClientInfo{},
+			""},
+		{"curl", "curl/8.5.0", ClientInfo{Browser: "curl", BrowserVersion: "8.5.0"}, "curl 8.5"},
+		{"空 UA", "", ClientInfo{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseUserAgent(tt.ua)
+			if got != tt.want {
+				t.Errorf("parseUserAgent = %+v\n期望 %+v", got, tt.want)
+			}
+			if s := got.Summary(catalogs["en"]); s != tt.summary {
+				t.Errorf("Summary = %q，期望 %q", s, tt.summary)
+			}
+		})
+	}
+}
+
+func TestParseClientInfoWindows11(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/ip", nil)
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36")
+	r.Header.Set("Sec-CH-UA-Full-Version-List", `"Google Chrome";v="129.0.6668.90", "Not=A?Brand";v="8.0.0.0", "Chromium";v="129.0.6668.90"`)
+	r.Header.Set("Sec-CH-UA-Platform", `"Windows"`)
+	r.Header.Set("Sec-CH-UA-Platform-Version", `"15.0.0"`)
+	r.Header.Set("Sec-CH-UA-Mobile", "?0")
+
+	info := parseClientInfo(r)
+	for lang, want := range map[string]string{
+		"en": "Chrome 129 · Windows 11 · Desktop",
+		"zh": "Chrome 129 · Windows 11 · 桌面",
+	} {
+		if got := info.Summary(catalogs[lang]); got != want {
+			t.Errorf("%s: Summary = %q，期望 %q", lang, got, want)
+		}
+	}
+}
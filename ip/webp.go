@@ -0,0 +1,664 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"image"
+	"io"
+)
+
+// 无损 WebP（VP8L）编码器，只实现卡片需要的部分：减绿变换、预测变换、
+// LZ77 后向引用和单组前缀码，不使用颜色缓存和元前缀码。
+// 格式说明见 https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+
+const (
+	vp8lSignature  = 0x2f
+	vp8lMaxSize    = 1 << 14
+	vp8lTileBits   = 5 // 预测变换的块大小 32×32
+	vp8lMaxLength  = 4096
+	vp8lMinLength  = 3
+	vp8lHashBits   = 16
+	vp8lLengthSyms = 24
+	vp8lDistSyms   = 40
+	maxCodeLength  = 15
+	maxCLCodeLen   = 7
+)
+
+// 变换类型
+const (
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+)
+
+// 预测模式，选用对卡片的渐变背景和纯色区域效果较好的几种
+const (
+	predictLeft   = 1
+	predictTop    = 2
+	predictSelect = 11
+	predictClamp  = 12
+)
+
+var vp8lPredictors = []uint32{predictLeft, predictTop, predictSelect, predictClamp}
+
+// codeLengthOrder 码长码的码长写入顺序
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// encodeWebP 将图像编码为无损 WebP
+func encodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= 0 || height <= 0 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return errWebPSize
+	}
+
+	argb, hasAlpha := toARGB(img)
+	subtractGreen(argb)
+	modes, residuals := predict(argb, width, height)
+
+	bw := &bitWriter{}
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // 版本
+
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+	bw.write(1, 1)
+	bw.write(transformPredictor, 2)
+	bw.write(vp8lTileBits-2, 3)
+	writeEntropyImage(bw, modes, subSampleSize(width, vp8lTileBits), false)
+	bw.write(0, 1) // 没有更多变换
+
+	writeEntropyImage(bw, residuals, width, true)
+	data := bw.bytes()
+
+	chunk := len(data)
+	pad := chunk & 1
+	var header [20]byte
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+chunk+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(chunk))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if pad != 0 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+type webpError string
+
+func (e webpError) Error() string { return string(e) }
+
+const errWebPSize = webpError("webp: 图像尺寸超出范围")
+
+// toARGB 转换为非预乘的 ARGB 像素，反预乘的舍入与 color.NRGBAModel 一致
+func toARGB(img image.Image) ([]uint32, bool) {
+	b := img.Bounds()
+	pix := make([]uint32, 0, b.Dx()*b.Dy())
+	hasAlpha := false
+	rgba, isRGBA := img.(*image.RGBA)
+	nrgba, isNRGBA := img.(*image.NRGBA)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if isNRGBA {
+				i := nrgba.PixOffset(x, y)
+				r, g, bl, a := uint32(nrgba.Pix[i]), uint32(nrgba.Pix[i+1]), uint32(nrgba.Pix[i+2]), uint32(nrgba.Pix[i+3])
+				hasAlpha = hasAlpha || a != 255
+				pix = append(pix, a<<24|r<<16|g<<8|bl)
+				continue
+			}
+
+			// 预乘的 16 位分量
+			var r, g, bl, a uint32
+			if isRGBA {
+				i := rgba.PixOffset(x, y)
+				r, g, bl, a = uint32(rgba.Pix[i])*0x101, uint32(rgba.Pix[i+1])*0x101, uint32(rgba.Pix[i+2])*0x101, uint32(rgba.Pix[i+3])*0x101
+			} else {
+				r, g, bl, a = img.At(x, y).RGBA()
+			}
+			switch a {
+			case 0xffff:
+			case 0:
+				r, g, bl = 0, 0, 0
+				hasAlpha = true
+			default:
+				r, g, bl = r*0xffff/a, g*0xffff/a, bl*0xffff/a
+				hasAlpha = true
+			}
+			pix = append(pix, a>>8<<24|r>>8<<16|g>>8<<8|bl>>8)
+		}
+	}
+	return pix, hasAlpha
+}
+
+// subtractGreen 红、蓝通道减去绿通道，降低通道间的相关性
+func subtractGreen(pix []uint32) {
+	for i, p := range pix {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		b := (p - g) & 0xff
+		pix[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// predict 为每个块选择残差最小的预测模式，返回模式子图像和残差
+func predict(pix []uint32, width, height int) ([]uint32, []uint32) {
+	tilesX, tilesY := subSampleSize(width, vp8lTileBits), subSampleSize(height, vp8lTileBits)
+	modes := make([]uint32, tilesX*tilesY)
+	residuals := make([]uint32, len(pix))
+	tile := 1 << vp8lTileBits
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := tx*tile, ty*tile
+			x1, y1 := min(x0+tile, width), min(y0+tile, height)
+
+			best, bestCost := uint32(predictLeft), -1
+			for _, mode := range vp8lPredictors {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						cost += residualCost(subPixels(pix[y*width+x], predictPixel(pix, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			modes[ty*tilesX+tx] = 0xff000000 | best<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					residuals[i] = subPixels(pix[i], predictPixel(pix, width, x, y, best))
+				}
+			}
+		}
+	}
+	return modes, residuals
+}
+
+// predictPixel 按规范计算预测值：左上角固定为不透明黑色，
+// 第一行用左侧像素，第一列用上方像素，其余按块的预测模式
+func predictPixel(pix []uint32, width, x, y int, mode uint32) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return pix[i-1]
+	case x == 0:
+		return pix[i-width]
+	}
+
+	l, t, tl := pix[i-1], pix[i-width], pix[i-width-1]
+	switch mode {
+	case predictTop:
+		return t
+	case predictSelect:
+		return selectPredict(l, t, tl)
+	case predictClamp:
+		return clampAddSubtractFull(l, t, tl)
+	default:
+		return l
+	}
+}
+
+func selectPredict(l, t, tl uint32) uint32 {
+	pl, pt := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		lc, tc, tlc := int(l>>shift&0xff), int(t>>shift&0xff), int(tl>>shift&0xff)
+		pl += abs(tc - tlc)
+		pt += abs(lc - tlc)
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+func clampAddSubtractFull(l, t, tl uint32) uint32 {
+	var out uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(l>>shift&0xff) + int(t>>shift&0xff) - int(tl>>shift&0xff)
+		out |= uint32(min(max(v, 0), 255)) << shift
+	}
+	return out
+}
+
+// subPixels 按通道相减，结果对 256 取模
+func subPixels(a, b uint32) uint32 {
+	ag := (a | 0x00ff00ff) - (b & 0xff00ff00)
+	rb := (a | 0xff00ff00) - (b & 0x00ff00ff)
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
+
+// residualCost 残差的大小，按有符号数计算，用于选择预测模式
+func residualCost(p uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		cost += abs(int(int8(p >> shift)))
+	}
+	return cost
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func subSampleSize(size, bits int) int {
+	return (size + 1<<bits - 1) >> bits
+}
+
+// lz77Token 字面像素或后向引用
+type lz77Token struct {
+	argb     uint32
+	length   int // 为 0 时是字面像素
+	distCode int
+}
+
+// backwardReferences 查找与左侧像素、上一行或哈希表中相同位置开始的重复，
+// 纯色区域和预测后残差为 0 的区域会被压缩为很少的后向引用
+func backwardReferences(pix []uint32, width int) []lz77Token {
+	var tokens []lz77Token
+	table := make([]int32, 1<<vp8lHashBits)
+	for i := range table {
+		table[i] = -1
+	}
+	hash := func(i int) uint32 {
+		h := pix[i]*0x1e35a7bd ^ pix[i+1]*0x9e3779b1 ^ pix[i+2]
+		return (h * 0x9e3779b1) >> (32 - vp8lHashBits)
+	}
+	matchLen := func(i, dist int) int {
+		n := 0
+		for i+n < len(pix) && n < vp8lMaxLength && pix[i+n] == pix[i+n-dist] {
+			n++
+		}
+		return n
+	}
+
+	for i := 0; i < len(pix); {
+		bestLen, bestDist := 0, 0
+		candidates := [3]int{1, width, 0}
+		if i+2 < len(pix) {
+			h := hash(i)
+			if prev := table[h]; prev >= 0 {
+				candidates[2] = i - int(prev)
+			}
+			table[h] = int32(i)
+		}
+		for _, dist := range candidates {
+			if dist <= 0 || dist > i {
+				continue
+			}
+			if n := matchLen(i, dist); n > bestLen {
+				bestLen, bestDist = n, dist
+			}
+		}
+
+		if bestLen < vp8lMinLength {
+			tokens = append(tokens, lz77Token{argb: pix[i]})
+			i++
+			continue
+		}
+		tokens = append(tokens, lz77Token{length: bestLen, distCode: distanceCode(bestDist, width)})
+		// 把被跳过的位置加入哈希表，后面可以引用
+		for j := i + 1; j < i+bestLen && j+2 < len(pix); j++ {
+			table[hash(j)] = int32(j)
+		}
+		i += bestLen
+	}
+	return tokens
+}
+
+// distanceCode 将像素距离转换为距离码，左侧和正上方像素有专用的短码
+func distanceCode(dist, width int) int {
+	switch dist {
+	case 1:
+		return 2
+	case width:
+		return 1
+	}
+	return dist + 120
+}
+
+// prefixEncode 将长度或距离码拆分为前缀码和附加位
+func prefixEncode(v int) (code, extraBits, extra int) {
+	v--
+	if v < 4 {
+		return v, 0, 0
+	}
+	hb := bitLen(v) - 1
+	second := (v >> (hb - 1)) & 1
+	extraBits = hb - 1
+	return 2*hb + second, extraBits, v & (1<<extraBits - 1)
+}
+
+func bitLen(v int) int {
+	n := 0
+	for ; v > 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+// writeEntropyImage 写入熵编码图像，主图像比子图像多一个元前缀码标志位
+func writeEntropyImage(bw *bitWriter, pix []uint32, width int, main bool) {
+	tokens := backwardReferences(pix, width)
+
+	green := make([]int, 256+vp8lLengthSyms)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	dist := make([]int, vp8lDistSyms)
+	for _, t := range tokens {
+		if t.length == 0 {
+			green[t.argb>>8&0xff]++
+			red[t.argb>>16&0xff]++
+			blue[t.argb&0xff]++
+			alpha[t.argb>>24]++
+			continue
+		}
+		code, _, _ := prefixEncode(t.length)
+		green[256+code]++
+		code, _, _ = prefixEncode(t.distCode)
+		dist[code]++
+	}
+
+	bw.write(0, 1) // 不使用颜色缓存
+	if main {
+		bw.write(0, 1) // 不使用元前缀码
+	}
+	codes := [5]*prefixCode{
+		writePrefixCode(bw, green),
+		writePrefixCode(bw, red),
+		writePrefixCode(bw, blue),
+		writePrefixCode(bw, alpha),
+		writePrefixCode(bw, dist),
+	}
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			codes[0].write(bw, int(t.argb>>8&0xff))
+			codes[1].write(bw, int(t.argb>>16&0xff))
+			codes[2].write(bw, int(t.argb&0xff))
+			codes[3].write(bw, int(t.argb>>24))
+			continue
+		}
+		code, n, extra := prefixEncode(t.length)
+		codes[0].write(bw, 256+code)
+		bw.write(uint32(extra), n)
+		code, n, extra = prefixEncode(t.distCode)
+		codes[4].write(bw, code)
+		bw.write(uint32(extra), n)
+	}
+}
+
+// prefixCode 规范 Huffman 编码，codes 已按写入顺序反转
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func (c *prefixCode) write(bw *bitWriter, symbol int) {
+	bw.write(c.codes[symbol], int(c.lengths[symbol]))
+}
+
+// writePrefixCode 根据频率生成前缀码并写入码长。只有 1～2 个小于 256 的符号时
+// 使用简单码；只有一个符号时解码器按 0 位读取，写入时同样不占位
+func writePrefixCode(bw *bitWriter, counts []int) *prefixCode {
+	var used []int
+	for sym, n := range counts {
+		if n > 0 {
+			used = append(used, sym)
+		}
+	}
+
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		c := &prefixCode{lengths: make([]uint8, len(counts)), codes: make([]uint32, len(counts))}
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		bw.write(1, 1) // 简单码
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+			c.lengths[used[0]], c.lengths[used[1]] = 1, 1
+			c.codes[used[1]] = 1
+		}
+		return c
+	}
+
+	lengths := huffmanLengths(counts, maxCodeLength)
+	bw.write(0, 1) // 普通码
+	writeCodeLengths(bw, lengths)
+	return newPrefixCode(lengths)
+}
+
+// writeCodeLengths 用码长码写入码长，连续的 0 用 17、18 压缩
+func writeCodeLengths(bw *bitWriter, lengths []uint8) {
+	type clToken struct{ sym, extra, extraBits int }
+	var tokens []clToken
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, clToken{sym: int(lengths[i])})
+			i++
+			continue
+		}
+		run := 0
+		for i+run < len(lengths) && lengths[i+run] == 0 {
+			run++
+		}
+		i += run
+		for run > 0 {
+			switch {
+			case run >= 11:
+				n := min(run, 138)
+				tokens = append(tokens, clToken{18, n - 11, 7})
+				run -= n
+			case run >= 3:
+				tokens = append(tokens, clToken{17, run - 3, 3})
+				run = 0
+			default:
+				tokens = append(tokens, clToken{sym: 0})
+				run--
+			}
+		}
+	}
+
+	counts := make([]int, len(codeLengthOrder))
+	for _, t := range tokens {
+		counts[t.sym]++
+	}
+	clLengths := huffmanLengths(counts, maxCLCodeLen)
+
+	n := len(codeLengthOrder)
+	for n > 4 && clLengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(uint32(n-4), 4)
+	for _, sym := range codeLengthOrder[:n] {
+		bw.write(uint32(clLengths[sym]), 3)
+	}
+	bw.write(0, 1) // 写入全部符号的码长
+
+	cl := newPrefixCode(clLengths)
+	for _, t := range tokens {
+		cl.write(bw, t.sym)
+		bw.write(uint32(t.extra), t.extraBits)
+	}
+}
+
+// newPrefixCode 由码长生成规范 Huffman 编码，位顺序反转以便按低位优先写入
+func newPrefixCode(lengths []uint8) *prefixCode {
+	c := &prefixCode{lengths: make([]uint8, len(lengths)), codes: make([]uint32, len(lengths))}
+	copy(c.lengths, lengths)
+
+	used := 0
+	for _, l := range lengths {
+		if l > 0 {
+			used++
+		}
+	}
+	// 只有一个符号时解码器不读取任何位
+	if used == 1 {
+		for i := range c.lengths {
+			c.lengths[i] = 0
+		}
+		return c
+	}
+
+	var count [maxCodeLength + 1]uint32
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+		}
+	}
+	var next [maxCodeLength + 2]uint32
+	code := uint32(0)
+	for bits := 1; bits <= maxCodeLength; bits++ {
+		code = (code + count[bits-1]) << 1
+		next[bits] = code
+	}
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c.codes[sym] = reverseBits(next[l], int(l))
+		next[l]++
+	}
+	return c
+}
+
+func reverseBits(v uint32, n int) uint32 {
+	var r uint32
+	for i := 0; i < n; i++ {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
+
+// huffmanLengths 计算码长不超过 limit 的 Huffman 码长，超出时将频率减半后重算。
+// 只有一个符号时码长为 1，用于在码长表中标记该符号
+func huffmanLengths(counts []int, limit int) []uint8 {
+	lengths := make([]uint8, len(counts))
+	freq := append([]int(nil), counts...)
+	for {
+		h := &huffmanHeap{}
+		for sym, n := range freq {
+			if n > 0 {
+				*h = append(*h, &huffmanNode{count: n, sym: sym})
+			}
+		}
+		switch h.Len() {
+		case 0:
+			return lengths
+		case 1:
+			lengths[(*h)[0].sym] = 1
+			return lengths
+		}
+
+		heap.Init(h)
+		for h.Len() > 1 {
+			a := heap.Pop(h).(*huffmanNode)
+			b := heap.Pop(h).(*huffmanNode)
+			heap.Push(h, &huffmanNode{count: a.count + b.count, sym: -1, left: a, right: b})
+		}
+
+		maxLen := 0
+		var walk func(n *huffmanNode, depth int)
+		walk = func(n *huffmanNode, depth int) {
+			if n.left == nil {
+				lengths[n.sym] = uint8(depth)
+				maxLen = max(maxLen, depth)
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk((*h)[0], 0)
+		if maxLen <= limit {
+			return lengths
+		}
+		for i, n := range freq {
+			if n > 0 {
+				freq[i] = max(n/2, 1)
+			}
+		}
+	}
+}
+
+type huffmanNode struct {
+	count       int
+	sym         int
+	left, right *huffmanNode
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].sym < h[j].sym
+}
+func (h huffmanHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x any)   { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() any {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// bitWriter 按低位优先写入位流
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits int
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	if n == 0 {
+		return
+	}
+	w.acc |= uint64(v&(1<<n-1)) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
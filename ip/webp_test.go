@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// 无损编码的结果经 x/image/webp 解码后应与原图逐像素相同
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	fill := func(img interface {
+		image.Image
+		Set(x, y int, c color.Color)
+	}, f func(x, y int) color.Color) {
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				img.Set(x, y, f(x, y))
+			}
+		}
+	}
+	nrgba := func(w, h int, f func(x, y int) color.Color) image.Image {
+		img := image.NewNRGBA(image.Rect(0, 0, w, h))
+		fill(img, f)
+		return img
+	}
+	rgba := func(w, h int, f func(x, y int) color.Color) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		fill(img, f)
+		return img
+	}
+	noise := func(int, int) color.Color {
+		return color.NRGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))}
+	}
+	gradient := func(x, y int) color.Color {
+		return color.NRGBA{uint8(x), uint8(y), uint8(x + y), 255}
+	}
+	stripes := func(x, y int) color.Color {
+		if (x/3+y)%4 == 0 {
+			return color.NRGBA{200, 30, 30, 255}
+		}
+		return color.NRGBA{20, 20, 40, 128}
+	}
+
+	gray := image.NewGray(image.Rect(0, 0, 40, 30))
+	fill(gray, func(x, y int) color.Color { return color.Gray{uint8(x * y)} })
+
+	s, d := testServer(t)
+	theme, _ := s.resolveTheme("dark")
+	card, err := webp.Decode(bytes.NewReader(s.generateImage(d, theme, formatWebP, 1, 90)))
+	if err != nil {
+		t.Fatalf("解码卡片失败: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"1x1", nrgba(1, 1, noise)},
+		{"单色", nrgba(64, 64, func(int, int) color.Color { return color.NRGBA{10, 20, 30, 255} })},
+		{"全透明", nrgba(50, 20, func(int, int) color.Color { return color.NRGBA{} })},
+		{"两种颜色", nrgba(64, 64, stripes)},
+		{"渐变", nrgba(256, 256, gradient)},
+		{"随机噪声", nrgba(97, 61, noise)},
+		{"非分块整数倍", nrgba(33, 17, gradient)},
+		{"宽条", nrgba(300, 3, stripes)},
+		{"窄条", nrgba(2, 300, gradient)},
+		{"预乘 RGBA 半透明", rgba(70, 40, noise)},
+		{"灰度", gray},
+		{"子图像", nrgba(80, 80, gradient).(*image.NRGBA).SubImage(image.Rect(10, 20, 50, 45))},
+		{"卡片", card},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeWebP(&buf, tt.img); err != nil {
+				t.Fatalf("编码失败: %v", err)
+			}
+			got, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("解码失败: %v", err)
+			}
+
+			b := tt.img.Bounds()
+			if got.Bounds().Dx() != b.Dx() || got.Bounds().Dy() != b.Dy() {
+				t.Fatalf("尺寸为 %v，期望 %v", got.Bounds(), b)
+			}
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					want := color.NRGBAModel.Convert(tt.img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+					have := color.NRGBAModel.Convert(got.At(x, y)).(color.NRGBA)
+					// 完全透明的像素颜色无意义
+					if want.A == 0 && have.A == 0 {
+						continue
+					}
+					if have != want {
+						t.Fatalf("像素 (%d,%d) 为 %v，期望 %v", x, y, have, want)
+					}
+				}
+			}
+		})
+	}
+}